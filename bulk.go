@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// maxParams ограничение SQLite на число параметров в одном запросе
+// (SQLITE_MAX_VARIABLE_NUMBER в старых сборках)
+const maxParams = 999
+
+// BatchAdd добавляет посылки в одной транзакции и возвращает их номера
+func (s ParcelStore) BatchAdd(parcels []Parcel) ([]int, error) {
+	return s.BatchAddContext(context.Background(), parcels)
+}
+
+// BatchAddContext добавляет посылки в одной транзакции, проверяя ctx перед каждой вставкой.
+// При отмене контекста транзакция откатывается и возвращается ctx.Err(),
+// так что частично добавленные посылки не сохраняются
+func (s ParcelStore) BatchAddContext(ctx context.Context, parcels []Parcel) ([]int, error) {
+	var ids []int
+	var statuses []string
+	err := s.updateContext(ctx, func(tx storeTx) error {
+		ids = make([]int, 0, len(parcels))
+		statuses = make([]string, 0, len(parcels))
+		for _, p := range parcels {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := s.checkCarrier(p.Carrier); err != nil {
+				return err
+			}
+			status, err := s.addStatus(p)
+			if err != nil {
+				return err
+			}
+
+			if err := checkNotes(p.Notes); err != nil {
+				return err
+			}
+			if err := checkDimensions(p.Length, p.Width, p.Height); err != nil {
+				return err
+			}
+
+			createdAt, err := s.createdAtArg(p.CreatedAt)
+			if err != nil {
+				return err
+			}
+
+			number, err := s.insertNumber(ctx, tx, insertQuery, p.Client, status, p.Address, createdAt, formatTime(s.now()), p.Priority, p.Carrier, p.Notes, p.Weight, p.Length, p.Width, p.Height)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, number)
+			statuses = append(statuses, status)
+		}
+
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range parcels {
+		s.emit(ParcelEvent{Op: EventAdded, Number: ids[i], Client: p.Client, Status: statuses[i], Address: p.Address})
+	}
+
+	return ids, nil
+}
+
+// UpsertMany вставляет посылки или обновляет уже существующие с тем же номером.
+// Посылки без номера всегда вставляются как новые, из нескольких посылок с одним
+// номером записывается последняя. Статус берётся из посылки:
+// пустой означает registered, неизвестный — ErrUnknownStatus. Все посылки
+// проверяются до начала записи, а запись идёт в одной транзакции пачками,
+// чтобы не превысить лимит параметров SQLite.
+// Возвращает количество вставленных и обновлённых посылок
+func (s ParcelStore) UpsertMany(parcels []Parcel) (inserted, updated int, err error) {
+	if len(parcels) == 0 {
+		return 0, 0, nil
+	}
+	parcels = dedupeByNumber(parcels)
+
+	statuses := make([]string, len(parcels))
+	createdAts := make([]any, len(parcels))
+	for i, p := range parcels {
+		if err := s.checkCarrier(p.Carrier); err != nil {
+			return 0, 0, err
+		}
+		if err := checkNotes(p.Notes); err != nil {
+			return 0, 0, err
+		}
+		if err := checkDimensions(p.Length, p.Width, p.Height); err != nil {
+			return 0, 0, err
+		}
+		if statuses[i], err = upsertStatus(p.Status); err != nil {
+			return 0, 0, err
+		}
+		if createdAts[i], err = s.createdAtArg(p.CreatedAt); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	const columns = 13
+	err = s.update(func(tx storeTx) error {
+		inserted, updated = 0, 0
+		updatedAt := formatTime(s.now())
+		chunkSize := maxParams / columns
+
+		var stmt *sql.Stmt
+		stmtSize := 0
+		defer func() {
+			if stmt != nil {
+				stmt.Close()
+			}
+		}()
+
+		for start := 0; start < len(parcels); start += chunkSize {
+			chunk := parcels[start:min(start+chunkSize, len(parcels))]
+
+			// одно подготовленное выражение на все полные пачки, отдельное — на последнюю
+			if stmt == nil || stmtSize != len(chunk) {
+				if stmt != nil {
+					stmt.Close()
+				}
+				var err error
+				stmt, err = tx.Prepare(upsertQuery(len(chunk)))
+				if err != nil {
+					return err
+				}
+				stmtSize = len(chunk)
+			}
+
+			existing, err := countExisting(tx, chunk)
+			if err != nil {
+				return err
+			}
+
+			args := make([]any, 0, len(chunk)*columns)
+			for i, p := range chunk {
+				var number any
+				if p.Number != 0 {
+					number = p.Number
+				}
+				args = append(args, number, p.Client, statuses[start+i], p.Address, createdAts[start+i], updatedAt, p.Priority, p.Carrier, p.Notes, p.Weight, p.Length, p.Width, p.Height)
+			}
+
+			if _, err := stmt.Exec(args...); err != nil {
+				return s.classifyError(err)
+			}
+
+			updated += existing
+			inserted += len(chunk) - existing
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return inserted, updated, nil
+}
+
+// dedupeByNumber оставляет для каждого номера последнюю посылку на месте первой,
+// чтобы UpsertMany не считал повтор номера отдельной вставкой или обновлением.
+// Посылки без номера не объединяются
+func dedupeByNumber(parcels []Parcel) []Parcel {
+	res := make([]Parcel, 0, len(parcels))
+	seen := make(map[int]int, len(parcels))
+	for _, p := range parcels {
+		if p.Number == 0 {
+			res = append(res, p)
+			continue
+		}
+		if i, ok := seen[p.Number]; ok {
+			res[i] = p
+			continue
+		}
+		seen[p.Number] = len(res)
+		res = append(res, p)
+	}
+
+	return res
+}
+
+// upsertStatus возвращает статус, с которым UpsertMany записывает посылку
+func upsertStatus(status string) (string, error) {
+	if status == "" {
+		return ParcelStatusRegistered, nil
+	}
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+
+	return status, nil
+}
+
+// upsertQuery строит INSERT ... ON CONFLICT на n строк
+func upsertQuery(n int) string {
+	rows := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", n), ", ")
+
+	return `INSERT INTO parcel ({number}, {client}, {status}, {address}, {created_at}, updated_at, priority, carrier, notes, weight, length, width, height) VALUES ` + rows + `
+		ON CONFLICT ({number}) DO UPDATE SET
+			{client} = excluded.{client},
+			{status} = excluded.{status},
+			{address} = excluded.{address},
+			{created_at} = excluded.{created_at},
+			updated_at = excluded.updated_at,
+			priority = excluded.priority,
+			carrier = excluded.carrier,
+			notes = excluded.notes,
+			weight = excluded.weight,
+			length = excluded.length,
+			width = excluded.width,
+			height = excluded.height`
+}
+
+// countExisting считает, сколько посылок пачки уже есть в таблице
+func countExisting(tx storeTx, chunk []Parcel) (int, error) {
+	var args []any
+	for _, p := range chunk {
+		if p.Number != 0 {
+			args = append(args, p.Number)
+		}
+	}
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM parcel WHERE {number} IN ("+placeholders(len(args))+")", args...).Scan(&n)
+
+	return n, err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpsertMany проверяет вставку и обновление посылок пачками
+func TestUpsertMany(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// посылок больше, чем помещается в одну пачку
+	parcels := make([]Parcel, 0, 500)
+	existing := getTestParcel()
+	existing.Number = id
+	existing.Status = ParcelStatusSent
+	existing.Address = "synced address"
+	parcels = append(parcels, existing)
+	for len(parcels) < cap(parcels) {
+		parcels = append(parcels, getTestParcel())
+	}
+
+	// upsert
+	inserted, updated, err := store.UpsertMany(parcels)
+	require.NoError(t, err)
+	require.Equal(t, 499, inserted)
+	require.Equal(t, 1, updated)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+	require.Equal(t, "synced address", stored.Address)
+
+	all, err := store.GetByClient(existing.Client)
+	require.NoError(t, err)
+	require.Len(t, all, 500)
+
+	// пустой статус — registered, неизвестный отклоняется до записи
+	empty := getTestParcel()
+	empty.Status = ""
+	inserted, _, err = store.UpsertMany([]Parcel{empty})
+	require.NoError(t, err)
+	require.Equal(t, 1, inserted)
+
+	bogus := getTestParcel()
+	bogus.Status = "bogus"
+	_, _, err = store.UpsertMany([]Parcel{getTestParcel(), bogus})
+	require.ErrorIs(t, err, ErrUnknownStatus)
+
+	statuses, err := store.DistinctStatuses()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{ParcelStatusRegistered, ParcelStatusSent}, statuses)
+	all, err = store.GetByClient(existing.Client)
+	require.NoError(t, err)
+	require.Len(t, all, 501)
+
+	// повтор номера: записывается последняя посылка, считается один раз
+	first, last := getTestParcel(), getTestParcel()
+	first.Number, last.Number = 100000, 100000
+	last.Address = "last"
+	inserted, updated, err = store.UpsertMany([]Parcel{first, last})
+	require.NoError(t, err)
+	require.Equal(t, 1, inserted)
+	require.Zero(t, updated)
+
+	first.Number, last.Number = id, id
+	inserted, updated, err = store.UpsertMany([]Parcel{first, last})
+	require.NoError(t, err)
+	require.Zero(t, inserted)
+	require.Equal(t, 1, updated)
+
+	for _, number := range []int{100000, id} {
+		stored, err := store.Get(number)
+		require.NoError(t, err)
+		require.Equal(t, "last", stored.Address)
+	}
+}
+
+// cancelAfter контекст, который считается отменённым после n проверок Err
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+
+	return nil
+}
+
+// TestBatchAdd проверяет добавление посылок пачкой
+func TestBatchAdd(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+	parcels := []Parcel{getTestParcel(), getTestParcel(), getTestParcel()}
+
+	// add
+	ids, err := store.BatchAdd(parcels)
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+
+	// check
+	for _, id := range ids {
+		stored, err := store.Get(id)
+		require.NoError(t, err)
+		require.Equal(t, ParcelStatusRegistered, stored.Status)
+	}
+}
+
+// TestBatchAddContextCancel проверяет, что при отмене посреди пачки ничего не сохраняется
+func TestBatchAddContextCancel(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+	parcels := []Parcel{getTestParcel(), getTestParcel(), getTestParcel()}
+
+	// контекст отменяется после второй вставки
+	ctx := &cancelAfter{Context: context.Background(), n: 2}
+
+	// add
+	ids, err := store.BatchAddContext(ctx, parcels)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Nil(t, ids)
+
+	// check
+	stored, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Empty(t, stored)
+}
+
+// BenchmarkBatchAdd измеряет добавление посылок пачками по 100 штук
+func BenchmarkBatchAdd(b *testing.B) {
+	const batch = 100
+
+	db := openTestDB(b)
+	store := NewParcelStore(db)
+	parcels := GenerateParcels(batch)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := store.BatchAdd(parcels)
+		require.NoError(b, err)
+	}
+}
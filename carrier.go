@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownCarrier возвращается для службы доставки не из списка WithCarriers
+var ErrUnknownCarrier = errors.New("unknown carrier")
+
+// WithCarriers ограничивает службы доставки, которые можно указать у посылки.
+// Без этой опции допускается любая служба. Пустая строка разрешена всегда
+// и означает, что служба ещё не выбрана
+func WithCarriers(carriers ...string) StoreOption {
+	return func(s *ParcelStore) {
+		s.carriers = make(map[string]bool, len(carriers))
+		for _, c := range carriers {
+			s.carriers[c] = true
+		}
+	}
+}
+
+// checkCarrier проверяет службу доставки по списку хранилища
+func (s ParcelStore) checkCarrier(carrier string) error {
+	if carrier == "" || s.carriers == nil || s.carriers[carrier] {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownCarrier, carrier)
+}
+
+// SetCarrier назначает посылке службу доставки
+func (s ParcelStore) SetCarrier(number int, carrier string) error {
+	if err := s.checkCarrier(carrier); err != nil {
+		return err
+	}
+
+	res, err := s.exec("UPDATE parcel SET carrier = ?, updated_at = ? WHERE {number} = ?",
+		carrier, formatTime(s.now()), number)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
+
+	return nil
+}
+
+// GetByCarrier возвращает посылки, назначенные службе доставки
+func (s ParcelStore) GetByCarrier(carrier string) ([]Parcel, error) {
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE carrier = ? ORDER BY {number}",
+		carrier)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestCarrier проверяет назначение службы доставки и выборку по ней
+func TestCarrier(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithCarriers("DHL", "Почта России"))
+
+	parcel := getTestParcel()
+	parcel.Carrier = "DHL"
+	dhl, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	local, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set carrier
+	err = store.SetCarrier(local, "Почта России")
+	require.NoError(t, err)
+
+	err = store.SetCarrier(local, "UPS")
+	require.ErrorIs(t, err, ErrUnknownCarrier)
+
+	parcel.Carrier = "UPS"
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrUnknownCarrier)
+
+	err = store.SetCarrier(local+1, "DHL")
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	// check
+	parcels, err := store.GetByCarrier("DHL")
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, dhl, parcels[0].Number)
+	require.Equal(t, "DHL", parcels[0].Carrier)
+
+	stored, err := store.Get(local)
+	require.NoError(t, err)
+	require.Equal(t, "Почта России", stored.Carrier)
+}
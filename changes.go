@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// changeColumns поля, которые можно менять через ApplyChanges, и их столбцы
+var changeColumns = map[string]string{
+	"address":  "{address}",
+	"status":   "{status}",
+	"notes":    "notes",
+	"priority": "priority",
+	"weight":   "weight",
+}
+
+// ApplyChanges меняет только переданные поля посылки одним UPDATE, например для PATCH в API.
+// Допустимые ключи: address, status, notes, priority, weight; неизвестный ключ или значение
+// неподходящего типа — ошибка, и посылка не меняется.
+// Смена статуса проверяется так же, как в SetStatus, адрес меняется только у посылки
+// в статусе registered. Поле с тем же значением изменением не считается; если ничего
+// не изменилось, посылка не записывается и updated_at не сдвигается
+func (s ParcelStore) ApplyChanges(number int, changes map[string]any) error {
+	return s.applyChanges(number, changes, false)
+}
+
+// ForceApplyChanges работает как ApplyChanges, но меняет адрес в любом статусе.
+// Предназначен для администраторов
+func (s ParcelStore) ForceApplyChanges(number int, changes map[string]any) error {
+	return s.applyChanges(number, changes, true)
+}
+
+func (s ParcelStore) applyChanges(number int, changes map[string]any, force bool) error {
+	values, err := validateChanges(changes)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	var current, status string
+	var statusChanged, addressChanged bool
+	err = s.update(func(tx storeTx) error {
+		statusChanged, addressChanged = false, false
+		var address, notes string
+		var priority int
+		var weight float64
+		err := tx.QueryRow("SELECT {status}, {address}, notes, priority, weight FROM parcel WHERE {number} = ?", number).
+			Scan(&current, &address, &notes, &priority, &weight)
+		if err != nil {
+			return notFound(err)
+		}
+
+		// поле с тем же значением изменением не считается
+		stored := map[string]any{"status": current, "address": address, "notes": notes, "priority": priority, "weight": weight}
+		keys := make([]string, 0, len(values))
+		for key, value := range values {
+			if value != stored[key] {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		status, statusChanged = values["status"].(string)
+		statusChanged = statusChanged && status != current
+		if statusChanged {
+			if err := validateTransition(current, status); err != nil {
+				return err
+			}
+		}
+		var newAddress string
+		newAddress, addressChanged = values["address"].(string)
+		addressChanged = addressChanged && newAddress != address
+		if addressChanged && !force && !isMutableStatus(current) {
+			return ErrParcelNotMutable
+		}
+
+		// порядок столбцов фиксирован, чтобы текст запроса не зависел от обхода карты
+		sort.Strings(keys)
+
+		changedAt := formatTime(s.now())
+		set := make([]string, 0, len(keys)+1)
+		args := make([]any, 0, len(keys)+2)
+		for _, key := range keys {
+			set = append(set, changeColumns[key]+" = ?")
+			args = append(args, values[key])
+		}
+		set = append(set, "updated_at = ?")
+		args = append(args, changedAt, number)
+
+		_, err = tx.Exec("UPDATE parcel SET "+strings.Join(set, ", ")+" WHERE {number} = ?", args...)
+		if err != nil {
+			return err
+		}
+
+		if !statusChanged {
+			return nil
+		}
+		if err := markDelivered(tx, number, status, changedAt); err != nil {
+			return err
+		}
+		if err := releaseOnRegistered(tx, number, status); err != nil {
+			return err
+		}
+		return s.recordHistory(tx, number, current, status, "", changedAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	if statusChanged {
+		s.emit(ParcelEvent{Op: EventStatusChanged, Number: number, PrevStatus: current, Status: status})
+	}
+	if addressChanged {
+		s.emit(ParcelEvent{Op: EventAddressChanged, Number: number, Address: values["address"].(string)})
+	}
+
+	return nil
+}
+
+// validateChanges проверяет ключи и типы значений ApplyChanges
+// и возвращает значения в том виде, в каком они пишутся в БД
+func validateChanges(changes map[string]any) (map[string]any, error) {
+	values := make(map[string]any, len(changes))
+	for key, value := range changes {
+		if _, ok := changeColumns[key]; !ok {
+			return nil, fmt.Errorf("unknown parcel field %q", key)
+		}
+
+		switch key {
+		case "priority":
+			n, ok := wholeNumber(value)
+			if !ok {
+				return nil, fmt.Errorf("field %q must be an integer, got %T", key, value)
+			}
+			values[key] = n
+		case "weight":
+			w, ok := weightValue(value)
+			if !ok {
+				return nil, fmt.Errorf("field %q must be a non-negative number, got %v", key, value)
+			}
+			values[key] = w
+		default:
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %q must be a string, got %T", key, value)
+			}
+			if key == "notes" {
+				if err := checkNotes(str); err != nil {
+					return nil, err
+				}
+			}
+			values[key] = str
+		}
+	}
+
+	return values, nil
+}
+
+// weightValue приводит вес к float64. Отрицательный вес недопустим
+func weightValue(value any) (float64, bool) {
+	var w float64
+	switch v := value.(type) {
+	case int:
+		w = float64(v)
+	case float64:
+		w = v
+	default:
+		return 0, false
+	}
+	if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+		return 0, false
+	}
+
+	return w, true
+}
+
+// wholeNumber приводит целое число к int. float64 принимается, если у него нет
+// дробной части: так приходят числа из encoding/json
+func wholeNumber(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		if v < math.MinInt || v > math.MaxInt {
+			return 0, false
+		}
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt || v > math.MaxInt {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
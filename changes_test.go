@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestApplyChanges проверяет частичное изменение посылки
+func TestApplyChanges(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// apply: priority из JSON приходит как float64
+	err = store.ApplyChanges(id, map[string]any{
+		"address":  "new address",
+		"notes":    "позвонить",
+		"priority": float64(2),
+		"weight":   3,
+	})
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "new address", stored.Address)
+	require.Equal(t, "позвонить", stored.Notes)
+	require.Equal(t, 2, stored.Priority)
+	require.Equal(t, 3.0, stored.Weight)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+
+	// status
+	err = store.ApplyChanges(id, map[string]any{"status": ParcelStatusSent, "priority": 5})
+	require.NoError(t, err)
+	history, err := store.GetHistory(id)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	// адрес отправленной посылки меняется только принудительно
+	err = store.ApplyChanges(id, map[string]any{"address": "other"})
+	require.ErrorIs(t, err, ErrParcelNotMutable)
+	err = store.ForceApplyChanges(id, map[string]any{"address": "other"})
+	require.NoError(t, err)
+
+	// ошибки не меняют посылку
+	err = store.ApplyChanges(id, map[string]any{"status": ParcelStatusRegistered, "notes": "x"})
+	require.ErrorIs(t, err, ErrInvalidTransition)
+	err = store.ApplyChanges(id, map[string]any{"client": 1})
+	require.Error(t, err)
+	err = store.ApplyChanges(id, map[string]any{"priority": 1.5})
+	require.Error(t, err)
+	err = store.ApplyChanges(id, map[string]any{"weight": -1.0})
+	require.Error(t, err)
+	err = store.ApplyChanges(id+1, map[string]any{"notes": "x"})
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "other", stored.Address)
+	require.Equal(t, "позвонить", stored.Notes)
+	require.Equal(t, 5, stored.Priority)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+}
+
+// TestApplyChangesUnchanged проверяет, что поля с теми же значениями не записываются
+func TestApplyChangesUnchanged(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	events := make(chan ParcelEvent, 10)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithEventChannel(events), WithClock(func() time.Time { return now }))
+	parcel := getTestParcel()
+
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	before, err := store.Get(id)
+	require.NoError(t, err)
+
+	// apply: тот же статус и тот же адрес
+	now = now.Add(time.Hour)
+	err = store.ApplyChanges(id, map[string]any{"status": ParcelStatusRegistered, "address": parcel.Address})
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, before.UpdatedAt, stored.UpdatedAt)
+
+	// тот же адрес вместе с другим полем: событие о смене адреса не отправляется
+	err = store.ApplyChanges(id, map[string]any{"address": parcel.Address, "notes": "позвонить"})
+	require.NoError(t, err)
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "позвонить", stored.Notes)
+	require.Equal(t, formatTime(now), stored.UpdatedAt)
+
+	// check
+	close(events)
+	var got []ParcelEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	require.Equal(t, []ParcelEvent{
+		{Op: EventAdded, Number: id, Client: parcel.Client, Status: ParcelStatusRegistered, Address: parcel.Address},
+	}, got)
+}
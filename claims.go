@@ -0,0 +1,84 @@
+package main
+
+import "errors"
+
+// ErrNoWorker возвращается, если идентификатор обработчика пустой
+var ErrNoWorker = errors.New("worker id is required")
+
+// ClaimNext берёт в работу обработчику workerID до limit свободных зарегистрированных
+// посылок в порядке GetNextToShip и возвращает их. Отбор и пометка выполняются
+// в одной транзакции, поэтому два обработчика не получат одну и ту же посылку
+func (s ParcelStore) ClaimNext(workerID string, limit int) ([]Parcel, error) {
+	if workerID == "" {
+		return nil, ErrNoWorker
+	}
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	var res []Parcel
+	err := s.update(func(tx storeTx) error {
+		rows, err := tx.Query("SELECT "+parcelColumns+` FROM parcel WHERE {status} = ? AND claimed_by = ''
+			ORDER BY priority DESC, {created_at}, {number} LIMIT ?`, ParcelStatusRegistered, limit)
+		if err != nil {
+			return err
+		}
+		res, err = collectRows(rows, scanParcelRows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, p := range res {
+			if _, err := tx.Exec("UPDATE parcel SET claimed_by = ? WHERE {number} = ?", workerID, p.Number); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetClaimedBy возвращает по возрастанию номера посылки, взятые в работу обработчиком workerID.
+// Отметка остаётся и после отправки посылки, так что по ней видно, какие посылки
+// обработчик успел провести дальше
+func (s ParcelStore) GetClaimedBy(workerID string) ([]Parcel, error) {
+	if workerID == "" {
+		return nil, ErrNoWorker
+	}
+
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE claimed_by = ? ORDER BY {number}", workerID)
+}
+
+// releaseOnRegistered снимает отметку обработчика с посылки, вернувшейся в registered
+// (lost -> registered), чтобы ClaimNext снова мог выдать её в работу
+func releaseOnRegistered(tx storeTx, number int, status string) error {
+	if status != ParcelStatusRegistered {
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE parcel SET claimed_by = '' WHERE {number} = ?", number)
+	return err
+}
+
+// ReleaseClaims возвращает в очередь ClaimNext все ещё зарегистрированные посылки
+// обработчика workerID, например после его падения, и возвращает их количество.
+// У посылок, которые уже ушли дальше, отметка сохраняется
+func (s ParcelStore) ReleaseClaims(workerID string) (int, error) {
+	if workerID == "" {
+		return 0, ErrNoWorker
+	}
+
+	res, err := s.exec("UPDATE parcel SET claimed_by = '' WHERE claimed_by = ? AND {status} = ?",
+		workerID, ParcelStatusRegistered)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
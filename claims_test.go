@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestClaims проверяет взятие посылок в работу, аудит и освобождение
+func TestClaims(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// claim
+	claimed, err := store.ClaimNext("w1", 2)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	require.Equal(t, numbers[0], claimed[0].Number)
+	require.Equal(t, numbers[1], claimed[1].Number)
+
+	other, err := store.ClaimNext("w2", 5)
+	require.NoError(t, err)
+	require.Len(t, other, 1)
+	require.Equal(t, numbers[2], other[0].Number)
+
+	// одну из посылок обработчик успел отправить
+	require.NoError(t, store.SetStatus(numbers[0], ParcelStatusSent))
+
+	got, err := store.GetClaimedBy("w1")
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, ParcelStatusSent, got[0].Status)
+
+	// release
+	n, err := store.ReleaseClaims("w1")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	got, err = store.GetClaimedBy("w1")
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, numbers[0], got[0].Number)
+
+	again, err := store.ClaimNext("w3", 5)
+	require.NoError(t, err)
+	require.Len(t, again, 1)
+	require.Equal(t, numbers[1], again[0].Number)
+
+	_, err = store.GetClaimedBy("")
+	require.ErrorIs(t, err, ErrNoWorker)
+
+	// неположительный limit — ошибка, а не выборка без ограничения
+	_, err = store.ClaimNext("w3", 0)
+	require.Error(t, err)
+	_, err = store.ClaimNext("w3", -1)
+	require.Error(t, err)
+}
+
+// TestReactivateReleasesClaim проверяет, что возвращённая в работу посылка снова выдаётся ClaimNext
+func TestReactivateReleasesClaim(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	claimed, err := store.ClaimNext("worker-1", 1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	// sent -> lost -> registered
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.MarkLost(id))
+	require.NoError(t, store.Reactivate(id))
+
+	// check
+	mine, err := store.GetClaimedBy("worker-1")
+	require.NoError(t, err)
+	require.Empty(t, mine)
+
+	claimed, err = store.ClaimNext("worker-2", 1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, id, claimed[0].Number)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect СУБД, под которую хранилище строит запросы и передаёт значения
+type Dialect string
+
+const (
+	// DialectSQLite используется по умолчанию: created_at хранится как TEXT
+	// в формате RFC3339 по UTC, параметры запросов обозначаются "?"
+	DialectSQLite Dialect = "sqlite"
+	// DialectPostgres рассчитан на created_at типа timestamptz: время
+	// передаётся в БД как time.Time, параметры обозначаются $1, $2, ...
+	DialectPostgres Dialect = "postgres"
+	// DialectMySQL передаёт запросы и значения так же, как DialectSQLite,
+	// но ошибки драйвера разбирает по кодам MySQL
+	DialectMySQL Dialect = "mysql"
+)
+
+// WithDialect задаёт диалект СУБД.
+//
+// Для всех диалектов Parcel.CreatedAt остаётся строкой RFC3339 по UTC,
+// а время как time.Time возвращает Parcel.CreatedTime. Чтение от диалекта не зависит:
+// значение столбца created_at типа TEXT или timestamptz приводится к строке RFC3339.
+// Нарушения уникальности и NOT NULL приводятся к ErrDuplicateParcel и ErrInvalidParcel.
+//
+// Номер новой посылки в Postgres читается через INSERT ... RETURNING, а не LastInsertId,
+// которого нет в lib/pq и pgx.
+//
+// Ограничения Postgres и MySQL: схему создают InitSchema и Migrate только для SQLite,
+// а GetByCreatedPrefix, DailyCounts, VerifySchema (pragma_table_info),
+// Truncate (sqlite_master, sqlite_sequence) и EstimateClientBytes (CAST AS BLOB)
+// рассчитаны на SQLite. В MySQL, кроме того,
+// не работают AddTag и UpsertMany (ON CONFLICT), DeleteMany и ForceDeleteMany (RETURNING)
+// и AnonymizeClient (|| как склейка строк)
+func WithDialect(d Dialect) StoreOption {
+	return func(s *ParcelStore) {
+		switch d {
+		case DialectSQLite, DialectPostgres, DialectMySQL:
+			s.dialect = d
+		default:
+			s.err = fmt.Errorf("unknown dialect %q", d)
+		}
+	}
+}
+
+// CreatedTime возвращает время создания посылки как time.Time
+func (p Parcel) CreatedTime() (time.Time, error) {
+	return time.Parse(time.RFC3339, p.CreatedAt)
+}
+
+// createdAtArg приводит created_at посылки к значению, которое передаётся в БД.
+// Для SQLite это исходная строка, для Postgres — разобранное время,
+// пустая строка для Postgres означает NULL
+func (s ParcelStore) createdAtArg(createdAt string) (any, error) {
+	if s.dialect != DialectPostgres {
+		return createdAt, nil
+	}
+	if createdAt == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid created_at %q: %w", createdAt, err)
+	}
+
+	return t.UTC(), nil
+}
+
+// timeArg приводит момент времени к значению для сравнения с created_at
+func (s ParcelStore) timeArg(t time.Time) any {
+	if s.dialect == DialectPostgres {
+		return t.UTC()
+	}
+
+	return formatTime(t)
+}
+
+// rebind заменяет параметры "?" на $1, $2, ... для Postgres.
+// Знаки вопроса внутри строковых литералов в одинарных кавычках не трогает
+func (s ParcelStore) rebind(query string) string {
+	if s.dialect != DialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// timestampText читает created_at как строку RFC3339 независимо от типа столбца:
+// TEXT в SQLite или timestamptz в Postgres. NULL читается как пустая строка
+type timestampText string
+
+func (t *timestampText) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*t = ""
+	case string:
+		*t = timestampText(v)
+	case []byte:
+		*t = timestampText(v)
+	case time.Time:
+		*t = timestampText(formatTime(v))
+	default:
+		return fmt.Errorf("unsupported created_at type %T", src)
+	}
+
+	return nil
+}
+
+// classifyError приводит нарушения ограничений, о которых драйвер диалекта сообщает
+// по-своему, к ErrDuplicateParcel и ErrInvalidParcel. Исходная ошибка остаётся в цепочке,
+// остальные ошибки возвращаются как есть
+func (s ParcelStore) classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var kind error
+	switch s.dialect {
+	case DialectPostgres:
+		kind = classifyPostgres(err)
+	case DialectMySQL:
+		kind = classifyMySQL(err)
+	default:
+		kind = classifySQLite(err)
+	}
+	if kind == nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// classifySQLite разбирает расширенные коды ошибок modernc.org/sqlite
+func classifySQLite(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return ErrDuplicateParcel
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+		return ErrInvalidParcel
+	}
+
+	return nil
+}
+
+// classifyPostgres разбирает SQLSTATE. Ошибки pgx (*pgconn.PgError) и lib/pq (*pq.Error)
+// отдают его методом SQLState, так что импортировать драйвер не нужно
+func classifyPostgres(err error) error {
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	switch pgErr.SQLState() {
+	case "23505": // unique_violation
+		return ErrDuplicateParcel
+	case "23502": // not_null_violation
+		return ErrInvalidParcel
+	}
+
+	return nil
+}
+
+// classifyMySQL разбирает номер ошибки MySQL. У *mysql.MySQLError из go-sql-driver/mysql
+// нет метода для номера, поэтому он читается из текста "Error 1062 (23000): ..."
+func classifyMySQL(err error) error {
+	var number int
+	if _, scanErr := fmt.Sscanf(err.Error(), "Error %d", &number); scanErr != nil {
+		return nil
+	}
+
+	switch number {
+	case 1062: // ER_DUP_ENTRY
+		return ErrDuplicateParcel
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		return ErrInvalidParcel
+	}
+
+	return nil
+}
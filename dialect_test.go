@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRebind проверяет замену параметров для Postgres
+func TestRebind(t *testing.T) {
+	pg := NewParcelStore(nil, WithDialect(DialectPostgres))
+	require.Equal(t, "SELECT number FROM parcel WHERE client = $1 AND address <> '?' AND status IN ($2, $3)",
+		pg.sqlText("SELECT {number} FROM parcel WHERE {client} = ? AND {address} <> '?' AND {status} IN (?, ?)"))
+
+	sqlite := NewParcelStore(nil)
+	require.Equal(t, "SELECT number FROM parcel WHERE client = ?", sqlite.sqlText("SELECT {number} FROM parcel WHERE {client} = ?"))
+
+	require.Error(t, NewParcelStore(openTestDB(t), WithDialect("oracle")).ready())
+}
+
+// TestCreatedAtDialect проверяет передачу и чтение created_at в разных диалектах
+func TestCreatedAtDialect(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	created := time.Date(2024, 6, 10, 15, 0, 0, 0, moscow)
+
+	// write
+	arg, err := NewParcelStore(nil).createdAtArg("2024-06-10T12:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, "2024-06-10T12:00:00Z", arg)
+
+	pg := NewParcelStore(nil, WithDialect(DialectPostgres))
+	arg, err = pg.createdAtArg("2024-06-10T15:00:00+03:00")
+	require.NoError(t, err)
+	require.True(t, created.Equal(arg.(time.Time)))
+	_, err = pg.createdAtArg("10.06.2024")
+	require.Error(t, err)
+
+	// read: timestamptz приходит из драйвера как time.Time
+	p, err := scanParcel(fakeRow{1, 1000, ParcelStatusRegistered, "test", created, "", 0, "", "", 0.0, 0.0, 0.0, 0.0})
+	require.NoError(t, err)
+	require.Equal(t, "2024-06-10T12:00:00Z", p.CreatedAt)
+
+	ct, err := p.CreatedTime()
+	require.NoError(t, err)
+	require.True(t, created.Equal(ct))
+}
+
+// pgError имитирует ошибку драйвера Postgres с кодом SQLSTATE
+type pgError struct {
+	code string
+}
+
+func (e *pgError) Error() string    { return "pg error " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+// TestClassifyError проверяет приведение ошибок драйверов к ошибкам пакета
+func TestClassifyError(t *testing.T) {
+	// sqlite: настоящие ошибки драйвера
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	_, err = db.Exec("INSERT INTO parcel (number, client, status, address, created_at) VALUES (?, 1000, 'registered', 'test', '')", id)
+	require.ErrorIs(t, store.classifyError(err), ErrDuplicateParcel)
+	_, err = db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (NULL, 'registered', 'test', '')")
+	require.ErrorIs(t, store.classifyError(err), ErrInvalidParcel)
+
+	// postgres и mysql: имитация ошибок драйверов
+	pg := NewParcelStore(nil, WithDialect(DialectPostgres))
+	mysql := NewParcelStore(nil, WithDialect(DialectMySQL))
+	tests := []struct {
+		store ParcelStore
+		err   error
+		want  error
+	}{
+		{pg, &pgError{"23505"}, ErrDuplicateParcel},
+		{pg, fmt.Errorf("insert: %w", &pgError{"23502"}), ErrInvalidParcel},
+		{pg, &pgError{"23503"}, nil},
+		{mysql, errors.New("Error 1062 (23000): Duplicate entry '1' for key 'parcel.PRIMARY'"), ErrDuplicateParcel},
+		{mysql, errors.New("Error 1048 (23000): Column 'client' cannot be null"), ErrInvalidParcel},
+		{mysql, errors.New("Error 1364 (HY000): Field 'address' doesn't have a default value"), ErrInvalidParcel},
+		{mysql, errors.New("Error 1213 (40001): Deadlock found"), nil},
+		{mysql, errors.New("connection refused"), nil},
+		// ошибка другого драйвера не разбирается
+		{pg, errors.New("Error 1062 (23000): Duplicate entry"), nil},
+	}
+	for _, tt := range tests {
+		got := tt.store.classifyError(tt.err)
+		require.ErrorIs(t, got, tt.err)
+		if tt.want == nil {
+			require.Equal(t, tt.err, got)
+			continue
+		}
+		require.ErrorIs(t, got, tt.want)
+	}
+
+	require.NoError(t, pg.classifyError(nil))
+}
+
+// noLastInsertIDDriver драйвер поверх SQLite, результаты которого, как в lib/pq и pgx,
+// не поддерживают LastInsertId. SQLite понимает параметры $1, $2 и RETURNING,
+// поэтому через него можно проверить вставку хранилища с DialectPostgres
+type noLastInsertIDDriver struct {
+	driver.Driver
+}
+
+func (d noLastInsertIDDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return noLastInsertIDConn{c}, nil
+}
+
+type noLastInsertIDConn struct {
+	driver.Conn
+}
+
+func (c noLastInsertIDConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return noLastInsertIDResult{res}, nil
+}
+
+func (c noLastInsertIDConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c noLastInsertIDConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+type noLastInsertIDResult struct {
+	driver.Result
+}
+
+func (noLastInsertIDResult) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported by this driver")
+}
+
+func init() {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register("sqlite-no-last-insert-id", noLastInsertIDDriver{db.Driver()})
+}
+
+// TestPostgresInsert проверяет, что вставки с DialectPostgres не зависят от LastInsertId
+func TestPostgresInsert(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite-no-last-insert-id", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, InitSchema(db))
+
+	// без RETURNING номер не получить
+	_, err = NewParcelStore(db).Add(getTestParcel())
+	require.Error(t, err)
+
+	store := NewParcelStore(db, WithDialect(DialectPostgres), WithHistory())
+
+	// add
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Positive(t, id)
+
+	copyID, err := store.Duplicate(id)
+	require.NoError(t, err)
+	withHistory, err := store.AddWithHistory(getTestParcel())
+	require.NoError(t, err)
+	batch, err := store.BatchAdd([]Parcel{getTestParcel(), getTestParcel()})
+	require.NoError(t, err)
+
+	// check
+	numbers := append([]int{id, copyID, withHistory}, batch...)
+	for _, number := range numbers {
+		p, err := store.Get(number)
+		require.NoError(t, err)
+		require.Equal(t, ParcelStatusRegistered, p.Status)
+	}
+	history, err := store.GetHistory(withHistory)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrInvalidDimensions возвращается, если какой-то из габаритов посылки отрицательный
+var ErrInvalidDimensions = errors.New("invalid parcel dimensions")
+
+// DefaultVolumetricDivisor делитель объёмного веса для габаритов в сантиметрах
+// и веса в килограммах, принятый у большинства служб доставки
+const DefaultVolumetricDivisor = 5000
+
+// checkDimensions проверяет, что габариты неотрицательные. Нули означают,
+// что габариты не измерены
+func checkDimensions(length, width, height float64) error {
+	for _, d := range []float64{length, width, height} {
+		if d < 0 || math.IsNaN(d) || math.IsInf(d, 0) {
+			return fmt.Errorf("%w: %v x %v x %v", ErrInvalidDimensions, length, width, height)
+		}
+	}
+
+	return nil
+}
+
+// SetDimensions задаёт габариты посылки в сантиметрах. Габариты можно менять в любом статусе
+func (s ParcelStore) SetDimensions(number int, length, width, height float64) error {
+	if err := checkDimensions(length, width, height); err != nil {
+		return err
+	}
+
+	res, err := s.exec("UPDATE parcel SET length = ?, width = ?, height = ?, updated_at = ? WHERE {number} = ?",
+		length, width, height, formatTime(s.now()), number)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
+
+	return nil
+}
+
+// VolumetricWeight возвращает объёмный вес посылки в килограммах: произведение
+// габаритов, делённое на divisor. У каждой службы доставки свой делитель,
+// divisor <= 0 означает DefaultVolumetricDivisor
+func (p Parcel) VolumetricWeight(divisor float64) float64 {
+	if divisor <= 0 {
+		divisor = DefaultVolumetricDivisor
+	}
+
+	return p.Length * p.Width * p.Height / divisor
+}
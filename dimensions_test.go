@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestDimensions проверяет сохранение габаритов и объёмный вес
+func TestDimensions(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	parcel := getTestParcel()
+	parcel.Length, parcel.Width, parcel.Height = 10, 20, 30
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, [3]float64{10, 20, 30}, [3]float64{stored.Length, stored.Width, stored.Height})
+
+	// set
+	require.NoError(t, store.SetDimensions(id, 50, 40, 30))
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, 12.0, stored.VolumetricWeight(0))
+	require.Equal(t, 10.0, stored.VolumetricWeight(6000))
+
+	// errors
+	require.ErrorIs(t, store.SetDimensions(id, 1, -1, 1), ErrInvalidDimensions)
+	require.ErrorIs(t, store.SetDimensions(id+1, 1, 1, 1), ErrParcelNotFound)
+	parcel.Height = -5
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrInvalidDimensions)
+}
@@ -0,0 +1,47 @@
+package main
+
+// EventOp вид изменения посылки
+type EventOp string
+
+const (
+	EventAdded          EventOp = "added"
+	EventStatusChanged  EventOp = "status_changed"
+	EventAddressChanged EventOp = "address_changed"
+	EventDeleted        EventOp = "deleted"
+)
+
+// ParcelEvent описывает зафиксированное изменение посылки.
+// Заполняются поля, относящиеся к операции: для EventAdded — Client, Status и Address,
+// для EventStatusChanged — PrevStatus и Status, для EventAddressChanged — Address,
+// для EventDeleted — только Number
+type ParcelEvent struct {
+	Op         EventOp
+	Number     int
+	Client     int
+	Status     string
+	PrevStatus string
+	Address    string
+}
+
+// WithEventChannel отправляет в ch событие после каждого успешно зафиксированного
+// добавления, смены статуса, смены адреса и удаления посылки.
+// Отправка не блокирует хранилище: если в канале нет места, событие отбрасывается,
+// поэтому канал стоит делать буферизованным и читать без задержек.
+// UpsertMany и Truncate событий не отправляют
+func WithEventChannel(ch chan<- ParcelEvent) StoreOption {
+	return func(s *ParcelStore) {
+		s.events = ch
+	}
+}
+
+// emit отправляет событие, если канал задан и в нём есть место
+func (s ParcelStore) emit(ev ParcelEvent) {
+	if s.events == nil {
+		return
+	}
+
+	select {
+	case s.events <- ev:
+	default:
+	}
+}
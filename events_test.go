@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEventChannel проверяет события о зафиксированных изменениях посылок
+func TestEventChannel(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	events := make(chan ParcelEvent, 10)
+	store := NewParcelStore(db, WithEventChannel(events))
+	parcel := getTestParcel()
+
+	// mutate
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.SetAddress(id, "new address"))
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	// неудачные операции событий не дают
+	require.Error(t, store.SetAddress(id, "other address"))
+	require.NoError(t, store.Delete(id))
+
+	other, err := store.Add(parcel)
+	require.NoError(t, err)
+	n, err := store.DeleteMany([]int{id, other})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// check
+	close(events)
+	var got []ParcelEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	require.Equal(t, []ParcelEvent{
+		{Op: EventAdded, Number: id, Client: parcel.Client, Status: ParcelStatusRegistered, Address: parcel.Address},
+		{Op: EventAddressChanged, Number: id, Address: "new address"},
+		{Op: EventStatusChanged, Number: id, PrevStatus: ParcelStatusRegistered, Status: ParcelStatusSent},
+		{Op: EventAdded, Number: other, Client: parcel.Client, Status: ParcelStatusRegistered, Address: parcel.Address},
+		{Op: EventDeleted, Number: other},
+	}, got)
+}
+
+// TestEventChannelFull проверяет, что заполненный канал не блокирует хранилище
+func TestEventChannelFull(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	events := make(chan ParcelEvent, 1)
+	store := NewParcelStore(db, WithEventChannel(events))
+
+	// mutate
+	for i := 0; i < 3; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// check
+	require.Len(t, events, 1)
+	require.Equal(t, 1, (<-events).Number)
+}
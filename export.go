@@ -0,0 +1,149 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// ExportJSONL записывает в w все посылки в формате JSON Lines: по объекту
+// на строку в порядке номеров. Таблица читается построчно и целиком в память не загружается
+func (s ParcelStore) ExportJSONL(w io.Writer) error {
+	return s.ExportJSONLContext(context.Background(), w)
+}
+
+// ExportJSONLContext работает как ExportJSONL и прекращает выгрузку при отмене ctx.
+// Уже записанные в w строки остаются, каждая из них — целый объект
+func (s ParcelStore) ExportJSONLContext(ctx context.Context, w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	return s.EachParcel(ctx, func(p Parcel) error {
+		return enc.Encode(p)
+	})
+}
+
+// Файлы архива ExportClientArchive
+const (
+	archiveParcels = "parcels.csv"
+	archiveHistory = "history.csv"
+)
+
+// ExportClientArchive записывает в w ZIP-архив со всеми данными клиента, например
+// для запроса на выгрузку персональных данных: parcels.csv с посылками клиента
+// и, если у его посылок есть история статусов, history.csv. Оба файла читаются
+// в одной транзакции и пишутся в архив построчно. У клиента без посылок архив
+// содержит только parcels.csv с заголовком. История удалённых посылок
+// в архив не попадает: по ней уже нельзя определить клиента.
+// При ошибке в w может остаться незаконченный архив
+func (s ParcelStore) ExportClientArchive(client int, w io.Writer) error {
+	tx, err := s.beginRead()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	zw := zip.NewWriter(w)
+	if err := exportClientParcels(tx, zw, client); err != nil {
+		return err
+	}
+	if s.history {
+		if err := exportClientHistory(tx, zw, client); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// exportClientParcels пишет в архив parcels.csv с посылками клиента в порядке номеров
+func exportClientParcels(tx storeTx, zw *zip.Writer, client int) error {
+	f, err := zw.Create(archiveParcels)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	err = cw.Write([]string{"number", "client", "status", "address", "created_at", "updated_at",
+		"priority", "carrier", "notes", "weight", "length", "width", "height"})
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT "+parcelColumns+" FROM parcel WHERE {client} = ? ORDER BY {number}", client)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return err
+		}
+		err = cw.Write([]string{strconv.Itoa(p.Number), strconv.Itoa(p.Client), p.Status, p.Address,
+			p.CreatedAt, p.UpdatedAt, strconv.Itoa(p.Priority), p.Carrier, p.Notes,
+			formatFloat(p.Weight), formatFloat(p.Length), formatFloat(p.Width), formatFloat(p.Height)})
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportClientHistory пишет в архив history.csv с историей статусов посылок клиента.
+// Файл создаётся только при первой записи истории
+func exportClientHistory(tx storeTx, zw *zip.Writer, client int) error {
+	rows, err := tx.Query(`SELECT h.number, h.from_status, h.to_status, h.reason, h.changed_at
+		FROM parcel_history h JOIN parcel p ON p.{number} = h.number
+		WHERE p.{client} = ? ORDER BY h.number, h.id`, client)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var cw *csv.Writer
+	for rows.Next() {
+		c := StatusChange{}
+		if err := rows.Scan(&c.Number, &c.From, &c.To, &c.Reason, &c.ChangedAt); err != nil {
+			return err
+		}
+
+		if cw == nil {
+			f, err := zw.Create(archiveHistory)
+			if err != nil {
+				return err
+			}
+			cw = csv.NewWriter(f)
+			if err := cw.Write([]string{"number", "from_status", "to_status", "reason", "changed_at"}); err != nil {
+				return err
+			}
+		}
+		if err := cw.Write([]string{strconv.Itoa(c.Number), c.From, c.To, c.Reason, c.ChangedAt}); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if cw == nil {
+		return nil
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatFloat записывает число без лишних знаков: 1.5, а не 1.500000
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
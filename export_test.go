@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportJSONL проверяет выгрузку посылок по объекту на строку
+func TestExportJSONL(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// export
+	var buf bytes.Buffer
+	require.NoError(t, store.ExportJSONL(&buf))
+
+	// check
+	var got []int
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var p Parcel
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &p))
+		require.Equal(t, "test", p.Address)
+		got = append(got, p.Number)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, numbers, got)
+
+	// cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf.Reset()
+	require.ErrorIs(t, store.ExportJSONLContext(ctx, &buf), context.Canceled)
+	require.Zero(t, buf.Len())
+}
+
+// readArchive разбирает ZIP-архив и возвращает содержимое CSV-файлов по именам
+func readArchive(t *testing.T, data []byte) map[string][][]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	res := map[string][][]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		records, err := csv.NewReader(r).ReadAll()
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		res[f.Name] = records
+	}
+
+	return res
+}
+
+// TestExportClientArchive проверяет архив с данными клиента
+func TestExportClientArchive(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	parcel := getTestParcel()
+	parcel.Address = "ул. Ленина, д. 1, \"кв. 2\""
+	parcel.Weight = 1.5
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	other := getTestParcel()
+	other.Client = 2000
+	otherID, err := store.Add(other)
+	require.NoError(t, err)
+
+	// export
+	var buf bytes.Buffer
+	require.NoError(t, store.ExportClientArchive(1000, &buf))
+	files := readArchive(t, buf.Bytes())
+
+	// check
+	require.Len(t, files[archiveParcels], 2)
+	row := files[archiveParcels][1]
+	require.Equal(t, strconv.Itoa(id), row[0])
+	require.Equal(t, ParcelStatusSent, row[2])
+	require.Equal(t, parcel.Address, row[3])
+	require.Equal(t, "1.5", row[9])
+
+	require.Equal(t, [][]string{
+		{"number", "from_status", "to_status", "reason", "changed_at"},
+		{strconv.Itoa(id), ParcelStatusRegistered, ParcelStatusSent, "", files[archiveHistory][1][4]},
+	}, files[archiveHistory])
+
+	// без истории файл истории не создаётся
+	buf.Reset()
+	require.NoError(t, store.ExportClientArchive(2000, &buf))
+	files = readArchive(t, buf.Bytes())
+	require.Len(t, files, 1)
+	require.Equal(t, strconv.Itoa(otherID), files[archiveParcels][1][0])
+
+	// клиент без данных
+	buf.Reset()
+	require.NoError(t, store.ExportClientArchive(3000, &buf))
+	files = readArchive(t, buf.Bytes())
+	require.Len(t, files, 1)
+	require.Len(t, files[archiveParcels], 1)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// generateSeed фиксированный seed, чтобы GenerateParcels всегда давал одни и те же данные
+const generateSeed = 42
+
+var (
+	generateCities  = []string{"Москва", "Псков", "Саратов", "Казань", "Томск", "Самара"}
+	generateStreets = []string{"Ленина", "Пушкина", "Колотушкина", "Козлова", "Садовая"}
+)
+
+// GenerateParcels возвращает n зарегистрированных посылок для бенчмарков и тестов.
+// Данные детерминированы: при одном и том же n результат всегда совпадает.
+// Клиентов примерно в десять раз меньше, чем посылок
+func GenerateParcels(n int) []Parcel {
+	r := rand.New(rand.NewSource(generateSeed))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clients := n/10 + 1
+
+	parcels := make([]Parcel, n)
+	for i := range parcels {
+		parcels[i] = Parcel{
+			Client: r.Intn(clients) + 1,
+			Status: ParcelStatusRegistered,
+			Address: fmt.Sprintf("%s, ул. %s, д. %d",
+				generateCities[r.Intn(len(generateCities))],
+				generateStreets[r.Intn(len(generateStreets))],
+				r.Intn(100)+1),
+			CreatedAt: formatTime(start.Add(time.Duration(i) * time.Minute)),
+		}
+	}
+
+	return parcels
+}
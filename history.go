@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrHistoryDisabled возвращается методами, которым нужна история статусов,
+	// если хранилище создано без WithHistory
+	ErrHistoryDisabled = errors.New("status history is disabled")
+	// ErrReasonRequired возвращается, если для смены статуса нужна причина
+	ErrReasonRequired = errors.New("reason is required for this status change")
+)
+
+// StatusChange запись истории статусов посылки
+type StatusChange struct {
+	Number    int
+	From      string
+	To        string
+	Reason    string
+	ChangedAt string
+	// Client клиент посылки, заполняется только GetStatusChangesBetween
+	Client int
+}
+
+// WithHistory включает запись смен статуса в таблицу parcel_history
+func WithHistory() StoreOption {
+	return func(s *ParcelStore) {
+		s.history = true
+	}
+}
+
+// SetStatusWithReason меняет статус посылки и записывает причину в историю.
+// Для переходов из reasonRequired причина обязательна
+func (s ParcelStore) SetStatusWithReason(number int, status string, reason string) error {
+	if !s.history {
+		return ErrHistoryDisabled
+	}
+
+	return s.changeStatus(number, status, reason, true)
+}
+
+// AddWithHistory добавляет посылку и начальную запись истории (из "" в её статус)
+// в одной транзакции, чтобы история импортированных посылок была полной.
+// Статус выбирается так же, как в Add: чтобы сохранить статус из источника,
+// хранилище создаётся с AllowExplicitStatusOnAdd
+func (s ParcelStore) AddWithHistory(p Parcel) (int, error) {
+	if !s.history {
+		return 0, ErrHistoryDisabled
+	}
+	if err := s.checkCarrier(p.Carrier); err != nil {
+		return 0, err
+	}
+	status, err := s.addStatus(p)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkNotes(p.Notes); err != nil {
+		return 0, err
+	}
+	if err := checkDimensions(p.Length, p.Width, p.Height); err != nil {
+		return 0, err
+	}
+
+	createdAt, err := s.createdAtArg(p.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	var number int
+	err = s.update(func(tx storeTx) error {
+		now := formatTime(s.now())
+		var err error
+		number, err = s.insertNumber(context.Background(), tx, insertQuery, p.Client, status, p.Address, createdAt, now, p.Priority, p.Carrier, p.Notes, p.Weight, p.Length, p.Width, p.Height)
+		if err != nil {
+			return err
+		}
+
+		return s.recordHistory(tx, number, "", status, "", now)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.emit(ParcelEvent{Op: EventAdded, Number: number, Client: p.Client, Status: status, Address: p.Address})
+
+	return number, nil
+}
+
+// changeStatus проверяет переход и меняет статус посылки вместе с записью в историю
+func (s ParcelStore) changeStatus(number int, status string, reason string, manual bool) error {
+	var current string
+	err := s.update(func(tx storeTx) error {
+		var err error
+		current, err = s.changeStatusTx(tx, number, status, reason, manual)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.emit(ParcelEvent{Op: EventStatusChanged, Number: number, PrevStatus: current, Status: status})
+
+	return nil
+}
+
+// changeStatusTx выполняет смену статуса внутри tx и возвращает прежний статус
+func (s ParcelStore) changeStatusTx(tx storeTx, number int, status string, reason string, manual bool) (string, error) {
+	var current string
+	err := tx.QueryRow("SELECT {status} FROM parcel WHERE {number} = ?", number).Scan(&current)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	if err := validateTransition(current, status); err != nil {
+		return "", err
+	}
+	if manual && reason == "" && reasonRequired[transition{current, status}] {
+		return "", fmt.Errorf("%w: %s -> %s", ErrReasonRequired, current, status)
+	}
+
+	changedAt := formatTime(s.now())
+	_, err = tx.Exec("UPDATE parcel SET {status} = ?, updated_at = ? WHERE {number} = ?", status, changedAt, number)
+	if err != nil {
+		return "", err
+	}
+	if err := markDelivered(tx, number, status, changedAt); err != nil {
+		return "", err
+	}
+	if err := releaseOnRegistered(tx, number, status); err != nil {
+		return "", err
+	}
+
+	if err := s.recordHistory(tx, number, current, status, reason, changedAt); err != nil {
+		return "", err
+	}
+
+	return current, nil
+}
+
+// markDelivered запоминает время доставки, если посылка перешла в статус delivered.
+// Из delivered переходов нет, поэтому время записывается один раз
+func markDelivered(tx storeTx, number int, status, changedAt string) error {
+	if status != ParcelStatusDelivered {
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE parcel SET delivered_at = ? WHERE {number} = ?", changedAt, number)
+	return err
+}
+
+// recordHistory записывает смену статуса в историю, если она включена
+func (s ParcelStore) recordHistory(tx storeTx, number int, from, to, reason, changedAt string) error {
+	if !s.history {
+		return nil
+	}
+
+	_, err := tx.Exec("INSERT INTO parcel_history (number, from_status, to_status, reason, changed_at) VALUES (?, ?, ?, ?, ?)",
+		number, from, to, reason, changedAt)
+	return err
+}
+
+// GetHistory возвращает историю статусов посылки в порядке изменений
+func (s ParcelStore) GetHistory(number int) ([]StatusChange, error) {
+	if err := s.ready(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query(historyQuery, number)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanHistory(rows.Rows)
+}
+
+// GetWithHistory возвращает посылку вместе с её историей статусов.
+// Оба чтения выполняются в одной транзакции, поэтому согласованы между собой
+func (s ParcelStore) GetWithHistory(number int) (Parcel, []StatusChange, error) {
+	p := Parcel{}
+	if !s.history {
+		return p, nil, ErrHistoryDisabled
+	}
+
+	tx, err := s.beginRead()
+	if err != nil {
+		return p, nil, err
+	}
+	defer tx.Rollback()
+
+	p, err = scanParcel(tx.QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE {number} = ?", number))
+	if err != nil {
+		return p, nil, notFound(err)
+	}
+
+	rows, err := tx.Query(historyQuery, number)
+	if err != nil {
+		return p, nil, err
+	}
+	defer rows.Close()
+
+	history, err := scanHistory(rows)
+	if err != nil {
+		return p, nil, err
+	}
+
+	return p, history, tx.Commit()
+}
+
+// TimeInStatus возвращает, сколько посылка провела в каждом статусе: от входа в статус
+// до следующей смены, а для текущего статуса — до текущего момента по часам хранилища.
+// Отсчёт начинается с created_at посылки, а если есть начальная запись AddWithHistory —
+// с её времени. Если посылка побывала в статусе несколько раз,
+// например вернулась в registered через Reactivate, время суммируется.
+// Если посылки нет, возвращается ErrParcelNotFound
+func (s ParcelStore) TimeInStatus(number int) (map[string]time.Duration, error) {
+	if !s.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	p, history, err := s.GetWithHistory(number)
+	if err != nil {
+		return nil, err
+	}
+
+	since, err := p.CreatedTime()
+	if err != nil {
+		return nil, fmt.Errorf("parcel %d: invalid created_at: %w", number, err)
+	}
+	status := p.Status
+	if len(history) > 0 {
+		status = history[0].From
+	}
+
+	res := map[string]time.Duration{}
+	for _, c := range history {
+		changedAt, err := time.Parse(time.RFC3339, c.ChangedAt)
+		if err != nil {
+			return nil, fmt.Errorf("parcel %d: invalid changed_at: %w", number, err)
+		}
+		// начальная запись AddWithHistory не закрывает никакого статуса
+		if status != "" {
+			res[status] += changedAt.Sub(since)
+		}
+		status, since = c.To, changedAt
+	}
+	res[status] += s.now().Sub(since)
+
+	return res, nil
+}
+
+// historyQuery читает историю статусов посылки в порядке изменений
+const historyQuery = `SELECT number, from_status, to_status, reason, changed_at FROM parcel_history
+	WHERE number = ? ORDER BY id`
+
+// scanHistory читает записи истории из rows
+func scanHistory(rows *sql.Rows) ([]StatusChange, error) {
+	res := []StatusChange{}
+	for rows.Next() {
+		c := StatusChange{}
+		err := rows.Scan(&c.Number, &c.From, &c.To, &c.Reason, &c.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetStatusChangesBetween возвращает смены статусов всех посылок в полуинтервале [from, to),
+// начиная с самых свежих, вместе с клиентом посылки — для ленты последних событий.
+// Смены статусов удалённых посылок в результат не попадают
+func (s ParcelStore) GetStatusChangesBetween(from, to time.Time) ([]StatusChange, error) {
+	if !s.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	return queryAll(s, func(rows *sql.Rows) (StatusChange, error) {
+		c := StatusChange{}
+		err := rows.Scan(&c.Number, &c.From, &c.To, &c.Reason, &c.ChangedAt, &c.Client)
+		return c, err
+	}, `SELECT h.number, h.from_status, h.to_status, h.reason, h.changed_at, p.{client}
+		FROM parcel_history h JOIN parcel p ON p.{number} = h.number
+		WHERE h.changed_at >= ? AND h.changed_at < ?
+		ORDER BY h.changed_at DESC, h.id DESC`, formatTime(from), formatTime(to))
+}
+
+// FindInvalidHistoryTransitions возвращает записи истории, переход в которых не допускается
+// правилами смены статуса, например из delivered обратно в sent после ручной правки БД.
+// Начальная запись из AddWithHistory (из "" в известный статус) нарушением не считается.
+// Записи идут в порядке добавления, данные не меняются
+func (s ParcelStore) FindInvalidHistoryTransitions() ([]StatusChange, error) {
+	if !s.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	rows, err := s.query("SELECT number, from_status, to_status, reason, changed_at FROM parcel_history ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history, err := scanHistory(rows.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []StatusChange{}
+	for _, c := range history {
+		if c.From == "" {
+			if _, ok := transitions[c.To]; ok {
+				continue
+			}
+		} else if validateTransition(c.From, c.To) == nil {
+			continue
+		}
+		res = append(res, c)
+	}
+
+	return res, nil
+}
+
+// FindOrphanHistory возвращает по возрастанию номера посылок, у которых есть
+// история, но самой посылки уже нет, например после ForceDeleteMany
+func (s ParcelStore) FindOrphanHistory() ([]int, error) {
+	return queryAll(s, scanInt, `SELECT DISTINCT h.number FROM parcel_history h
+		WHERE NOT EXISTS (SELECT 1 FROM parcel p WHERE p.{number} = h.number)
+		ORDER BY h.number`)
+}
+
+// CleanOrphanHistory удаляет историю посылок, которых нет в таблице parcel,
+// и возвращает количество удалённых записей.
+//
+// Альтернатива — внешний ключ с ON DELETE CASCADE. Но в SQLite его можно добавить
+// только пересозданием таблицы, действует он лишь при PRAGMA foreign_keys = ON
+// на каждом подключении, а история при удалении посылки пропадает безвозвратно.
+// Отдельная очистка оставляет историю удалённых посылок до явного решения её стереть
+func (s ParcelStore) CleanOrphanHistory() (int, error) {
+	res, err := s.exec(`DELETE FROM parcel_history
+		WHERE NOT EXISTS (SELECT 1 FROM parcel p WHERE p.{number} = parcel_history.number)`)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetStatusWithReason проверяет смену статуса с записью причины в историю
+func TestSetStatusWithReason(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set status
+	err = store.SetStatusWithReason(id, ParcelStatusSent, "передана курьеру")
+	require.NoError(t, err)
+
+	// для подтверждения доставки вручную причина обязательна
+	err = store.SetStatusWithReason(id, ParcelStatusDelivered, "")
+	require.ErrorIs(t, err, ErrReasonRequired)
+
+	err = store.SetStatusWithReason(id, ParcelStatusRegistered, "ошибка оператора")
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	err = store.SetStatusWithReason(id, ParcelStatusDelivered, "клиент подтвердил по телефону")
+	require.NoError(t, err)
+
+	// check
+	history, err := store.GetHistory(id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, ParcelStatusRegistered, history[0].From)
+	require.Equal(t, ParcelStatusSent, history[0].To)
+	require.Equal(t, "передана курьеру", history[0].Reason)
+	require.Equal(t, ParcelStatusDelivered, history[1].To)
+	require.Equal(t, "клиент подтвердил по телефону", history[1].Reason)
+}
+
+// TestSetStatusWithReasonDisabled проверяет, что без истории причину некуда записать
+func TestSetStatusWithReasonDisabled(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	err = store.SetStatusWithReason(id, ParcelStatusSent, "передана курьеру")
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+// TestGetWithHistory проверяет получение посылки вместе с историей
+func TestGetWithHistory(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// get
+	parcel, history, err := store.GetWithHistory(id)
+	require.NoError(t, err)
+	require.Equal(t, id, parcel.Number)
+	require.Equal(t, ParcelStatusSent, parcel.Status)
+	require.Len(t, history, 1)
+	require.Equal(t, ParcelStatusSent, history[0].To)
+
+	// not found
+	_, _, err = store.GetWithHistory(id + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	// без журнала истории нет
+	_, _, err = NewParcelStore(db).GetWithHistory(id)
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+// TestAddWithHistory проверяет начальную запись истории у добавленной посылки
+func TestAddWithHistory(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithHistory(), AllowExplicitStatusOnAdd(), WithClock(func() time.Time { return now }))
+	parcel := getTestParcel()
+	parcel.Status = ParcelStatusSent
+
+	// add
+	id, err := store.AddWithHistory(parcel)
+	require.NoError(t, err)
+
+	// check
+	stored, history, err := store.GetWithHistory(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+	require.Equal(t, []StatusChange{{Number: id, From: "", To: ParcelStatusSent, ChangedAt: "2024-06-10T12:00:00Z"}}, history)
+
+	// без истории метод недоступен
+	_, err = NewParcelStore(db).AddWithHistory(parcel)
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+// TestGetStatusChangesBetween проверяет ленту смен статусов за период
+func TestGetStatusChangesBetween(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithHistory(), WithClock(func() time.Time { return now }))
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	parcel := getTestParcel()
+	parcel.Client = 1001
+	second, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetStatus(first, ParcelStatusSent))
+	now = now.Add(time.Hour)
+	require.NoError(t, store.SetStatus(second, ParcelStatusSent))
+	now = now.Add(time.Hour)
+	require.NoError(t, store.SetStatusWithReason(first, ParcelStatusDelivered, "вручена"))
+
+	// check: свежие первыми, правая граница не включается
+	from := time.Date(2024, 6, 10, 13, 0, 0, 0, time.UTC)
+	changes, err := store.GetStatusChangesBetween(from, from.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []StatusChange{
+		{Number: first, From: ParcelStatusSent, To: ParcelStatusDelivered, Reason: "вручена", ChangedAt: "2024-06-10T14:00:00Z", Client: 1000},
+		{Number: second, From: ParcelStatusRegistered, To: ParcelStatusSent, ChangedAt: "2024-06-10T13:00:00Z", Client: 1001},
+	}, changes)
+
+	changes, err = store.GetStatusChangesBetween(from, from.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	// без истории метод недоступен
+	_, err = NewParcelStore(db).GetStatusChangesBetween(from, from.Add(time.Hour))
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+// TestOrphanHistory проверяет поиск и очистку истории удалённых посылок
+func TestOrphanHistory(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+		numbers = append(numbers, id)
+	}
+	_, err := store.ForceDeleteMany([]int{numbers[0], numbers[2]})
+	require.NoError(t, err)
+
+	// find
+	orphans, err := store.FindOrphanHistory()
+	require.NoError(t, err)
+	require.Equal(t, []int{numbers[0], numbers[2]}, orphans)
+
+	// clean
+	n, err := store.CleanOrphanHistory()
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	orphans, err = store.FindOrphanHistory()
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+
+	history, err := store.GetHistory(numbers[1])
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+}
+
+// TestFindInvalidHistoryTransitions проверяет поиск недопустимых переходов в истории
+func TestFindInvalidHistoryTransitions(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	id, err := store.AddWithHistory(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.SetStatusWithReason(id, ParcelStatusDelivered, "вручено"))
+
+	invalid, err := store.FindInvalidHistoryTransitions()
+	require.NoError(t, err)
+	require.NotNil(t, invalid)
+	require.Empty(t, invalid)
+
+	// ручная правка истории
+	for _, pair := range [][2]string{{ParcelStatusDelivered, ParcelStatusSent}, {"", "unknown"}} {
+		_, err = db.Exec("INSERT INTO parcel_history (number, from_status, to_status, reason, changed_at) VALUES (?, ?, ?, '', ?)",
+			id, pair[0], pair[1], getTestParcel().CreatedAt)
+		require.NoError(t, err)
+	}
+
+	// check
+	invalid, err = store.FindInvalidHistoryTransitions()
+	require.NoError(t, err)
+	require.Len(t, invalid, 2)
+	require.Equal(t, id, invalid[0].Number)
+	require.Equal(t, ParcelStatusDelivered, invalid[0].From)
+	require.Equal(t, ParcelStatusSent, invalid[0].To)
+	require.Equal(t, "unknown", invalid[1].To)
+
+	_, err = NewParcelStore(db).FindInvalidHistoryTransitions()
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+// TestTimeInStatus проверяет расчёт времени, проведённого посылкой в каждом статусе
+func TestTimeInStatus(t *testing.T) {
+	// prepare
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory(), WithClock(func() time.Time { return now }))
+
+	parcel := getTestParcel()
+	parcel.CreatedAt = formatTime(now)
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	now = now.Add(3 * time.Hour)
+	require.NoError(t, store.SetStatusWithReason(id, ParcelStatusLost, "не найдена"))
+	now = now.Add(time.Hour)
+	require.NoError(t, store.SetStatus(id, ParcelStatusRegistered))
+	now = now.Add(30 * time.Minute)
+
+	// check
+	durations, err := store.TimeInStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		ParcelStatusRegistered: 2*time.Hour + 30*time.Minute,
+		ParcelStatusSent:       3 * time.Hour,
+		ParcelStatusLost:       time.Hour,
+	}, durations)
+
+	// начальная запись AddWithHistory
+	added, err := store.AddWithHistory(parcel)
+	require.NoError(t, err)
+	now = now.Add(time.Hour)
+	durations, err = store.TimeInStatus(added)
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{ParcelStatusRegistered: time.Hour}, durations)
+
+	_, err = store.TimeInStatus(added + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// integritySamples сколько номеров посылок IntegrityReport хранит для каждой проблемы
+const integritySamples = 10
+
+// IntegrityIssue число посылок с одной проблемой и номера первых из них
+type IntegrityIssue struct {
+	Count   int
+	Samples []int
+}
+
+// add учитывает посылку number
+func (i *IntegrityIssue) add(number int) {
+	i.Count++
+	if len(i.Samples) < integritySamples {
+		i.Samples = append(i.Samples, number)
+	}
+}
+
+// IntegrityReport результат CheckIntegrity. Одна посылка может попасть в несколько категорий
+type IntegrityReport struct {
+	// InvalidStatus статус не входит в число известных
+	InvalidStatus IntegrityIssue
+	// EmptyAddress адрес пустой или состоит из пробелов
+	EmptyAddress IntegrityIssue
+	// InvalidCreatedAt created_at не разбирается как RFC3339
+	InvalidCreatedAt IntegrityIssue
+	// InvalidClient номер клиента не положительный
+	InvalidClient IntegrityIssue
+}
+
+// OK сообщает, что проблем не найдено
+func (r IntegrityReport) OK() bool {
+	return r.InvalidStatus.Count == 0 && r.EmptyAddress.Count == 0 &&
+		r.InvalidCreatedAt.Count == 0 && r.InvalidClient.Count == 0
+}
+
+// CheckIntegrity проверяет всю таблицу посылок и возвращает число нарушений по категориям
+// вместе с номерами первых посылок в каждой (по возрастанию номера).
+// Это диагностика перед чисткой данных, таблица не меняется.
+// NULL в столбце считается нарушением соответствующей категории
+func (s ParcelStore) CheckIntegrity() (IntegrityReport, error) {
+	rows, err := s.query("SELECT {number}, {client}, {status}, {address}, {created_at} FROM parcel ORDER BY {number}")
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	defer rows.Close()
+
+	report := IntegrityReport{
+		InvalidStatus:    IntegrityIssue{Samples: []int{}},
+		EmptyAddress:     IntegrityIssue{Samples: []int{}},
+		InvalidCreatedAt: IntegrityIssue{Samples: []int{}},
+		InvalidClient:    IntegrityIssue{Samples: []int{}},
+	}
+	for rows.Next() {
+		var number int
+		var client sql.NullInt64
+		var status, address, createdAt sql.NullString
+		if err := rows.Scan(&number, &client, &status, &address, &createdAt); err != nil {
+			return IntegrityReport{}, err
+		}
+
+		if _, ok := transitions[status.String]; !ok {
+			report.InvalidStatus.add(number)
+		}
+		if strings.TrimSpace(address.String) == "" {
+			report.EmptyAddress.add(number)
+		}
+		if _, err := time.Parse(time.RFC3339, createdAt.String); err != nil {
+			report.InvalidCreatedAt.add(number)
+		}
+		if client.Int64 <= 0 {
+			report.InvalidClient.add(number)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return IntegrityReport{}, err
+	}
+
+	return report, nil
+}
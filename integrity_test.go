@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckIntegrity проверяет отчёт о нарушениях в таблице посылок
+func TestCheckIntegrity(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	report, err := store.CheckIntegrity()
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Empty(t, report.InvalidStatus.Samples)
+
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	insert := func(client int, status, address, createdAt string) int {
+		res, err := db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (?, ?, ?, ?)",
+			client, status, address, createdAt)
+		require.NoError(t, err)
+		id, err := res.LastInsertId()
+		require.NoError(t, err)
+		return int(id)
+	}
+	createdAt := getTestParcel().CreatedAt
+	badStatus := insert(1000, "Sent", "test", createdAt)
+	badAddress := insert(1000, ParcelStatusRegistered, "  ", createdAt)
+	badTime := insert(1000, ParcelStatusRegistered, "test", "01.06.2024 10:00")
+	badClient := insert(0, "", "test", createdAt)
+
+	// check
+	report, err = store.CheckIntegrity()
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, IntegrityIssue{Count: 2, Samples: []int{badStatus, badClient}}, report.InvalidStatus)
+	require.Equal(t, IntegrityIssue{Count: 1, Samples: []int{badAddress}}, report.EmptyAddress)
+	require.Equal(t, IntegrityIssue{Count: 1, Samples: []int{badTime}}, report.InvalidCreatedAt)
+	require.Equal(t, IntegrityIssue{Count: 1, Samples: []int{badClient}}, report.InvalidClient)
+}
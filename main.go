@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
 
@@ -12,6 +11,7 @@ const (
 	ParcelStatusRegistered = "registered"
 	ParcelStatusSent       = "sent"
 	ParcelStatusDelivered  = "delivered"
+	ParcelStatusLost       = "lost"
 )
 
 type Parcel struct {
@@ -20,6 +20,20 @@ type Parcel struct {
 	Status    string
 	Address   string
 	CreatedAt string
+	UpdatedAt string
+	Priority  int
+	Carrier   string
+	Notes     string
+	Weight    float64
+	Length    float64
+	Width     float64
+	Height    float64
+}
+
+// String возвращает краткое описание посылки для логов. Адрес не выводится,
+// чтобы длинные адреса не попадали в логи
+func (p Parcel) String() string {
+	return fmt.Sprintf("Parcel#%d client=%d status=%s", p.Number, p.Client, p.Status)
 }
 
 type ParcelService struct {
@@ -79,7 +93,7 @@ func (s ParcelService) NextStatus(number int) error {
 		nextStatus = ParcelStatusSent
 	case ParcelStatusSent:
 		nextStatus = ParcelStatusDelivered
-	case ParcelStatusDelivered:
+	case ParcelStatusDelivered, ParcelStatusLost:
 		return nil
 	}
 
@@ -97,9 +111,19 @@ func (s ParcelService) Delete(number int) error {
 }
 
 func main() {
-	// настройте подключение к БД
+	db, err := OpenSQLite("tracker.db")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer db.Close()
+
+	if err := Migrate(db); err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	store := // создайте объект ParcelStore функцией NewParcelStore
+	store := NewParcelStore(db)
 	service := NewParcelService(store)
 
 	// регистрация посылки
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration шаг изменения схемы. Шаг должен быть идемпотентным:
+// повторное применение к уже изменённой схеме ничего не ломает
+type migration func(tx *sql.Tx) error
+
+// migrations шаги схемы по порядку, версия схемы — количество применённых шагов.
+// Новые шаги добавляются только в конец
+var migrations = []migration{
+	// 1: исходные таблицы
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS parcel (
+			number     INTEGER PRIMARY KEY AUTOINCREMENT,
+			client     INTEGER      NOT NULL,
+			status     VARCHAR(128) NOT NULL,
+			address    VARCHAR(512) NOT NULL,
+			created_at TEXT         NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS parcel_history (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			number      INTEGER NOT NULL,
+			from_status TEXT    NOT NULL,
+			to_status   TEXT    NOT NULL,
+			reason      TEXT    NOT NULL DEFAULT '',
+			changed_at  TEXT    NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS parcel_tag (
+			number INTEGER NOT NULL,
+			tag    TEXT    NOT NULL,
+			PRIMARY KEY (number, tag)
+		)`)
+		return err
+	},
+	// 2: время последнего изменения посылки. У старых посылок это время создания,
+	// иначе пустая строка оказалась бы раньше любого времени и GetUpdatedSince их не нашёл бы.
+	// В унаследованной таблице столбец времени создания может называться иначе,
+	// тогда updated_at остаётся пустым
+	func(tx *sql.Tx) error {
+		if err := addColumn(tx, "parcel", "updated_at", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		exists, err := hasColumn(tx, "parcel", "created_at")
+		if err != nil || !exists {
+			return err
+		}
+		_, err = tx.Exec("UPDATE parcel SET updated_at = COALESCE(created_at, '') WHERE updated_at = ''")
+		return err
+	},
+	// 3: приоритет отправки, у срочных посылок он выше
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "parcel", "priority", "INTEGER NOT NULL DEFAULT 0")
+	},
+	// 4: служба доставки, пустая строка — служба ещё не выбрана
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "parcel", "carrier", "TEXT NOT NULL DEFAULT ''")
+	},
+	// 5: заметки службы поддержки
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "parcel", "notes", "TEXT NOT NULL DEFAULT ''")
+	},
+	// 6: обработчик, взявший посылку в работу, пустая строка — посылка свободна
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "parcel", "claimed_by", "TEXT NOT NULL DEFAULT ''")
+	},
+	// 7: вес посылки в килограммах
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "parcel", "weight", "REAL NOT NULL DEFAULT 0")
+	},
+	// 8: время доставки, пустая строка — посылка ещё не доставлена
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "parcel", "delivered_at", "TEXT NOT NULL DEFAULT ''")
+	},
+	// 9: габариты посылки в сантиметрах
+	func(tx *sql.Tx) error {
+		for _, column := range []string{"length", "width", "height"} {
+			if err := addColumn(tx, "parcel", column, "REAL NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// schemaVersion текущая версия схемы
+var schemaVersion = len(migrations)
+
+// Migrate применяет недостающие шаги схемы и запоминает версию в таблице schema_version.
+// Повторный вызов на актуальной схеме ничего не делает
+func Migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)")
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	err = tx.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := tx.Exec("INSERT INTO schema_version (version) VALUES (0)"); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	if version > schemaVersion {
+		return fmt.Errorf("schema version %d is newer than supported %d", version, schemaVersion)
+	}
+
+	for i := version; i < schemaVersion; i++ {
+		if err := migrations[i](tx); err != nil {
+			return fmt.Errorf("migrate to version %d: %w", i+1, err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE schema_version SET version = ?", schemaVersion); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addColumn добавляет столбец в таблицу, если его там ещё нет
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	exists, err := hasColumn(tx, table, column)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// hasColumn проверяет, есть ли в таблице table столбец column
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&exists)
+
+	return exists, err
+}
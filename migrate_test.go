@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrate проверяет, что миграции применяются к старой базе и безопасны при повторе
+func TestMigrate(t *testing.T) {
+	// prepare
+	// база в том виде, в каком она была до появления schema_version
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE parcel (
+		number     INTEGER PRIMARY KEY AUTOINCREMENT,
+		client     INTEGER      NOT NULL,
+		status     VARCHAR(128) NOT NULL,
+		address    VARCHAR(512) NOT NULL,
+		created_at TEXT         NOT NULL
+	)`)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (?, ?, ?, ?)",
+		1000, ParcelStatusRegistered, "test", "2024-06-01T10:00:00Z")
+	require.NoError(t, err)
+
+	// migrate
+	require.NoError(t, Migrate(db))
+	require.NoError(t, Migrate(db))
+
+	// check
+	var version int
+	err = db.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	require.NoError(t, err)
+	require.Equal(t, schemaVersion, version)
+
+	parcels, err := NewParcelStore(db).GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.NoError(t, VerifySchema(db))
+
+	// старая посылка считается изменённой в момент создания
+	require.Equal(t, "2024-06-01T10:00:00Z", parcels[0].UpdatedAt)
+	updated, err := NewParcelStore(db).GetUpdatedSince(time.Time{})
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+}
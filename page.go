@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidOrder возвращается, если поле сортировки не входит в orderColumns
+var ErrInvalidOrder = errors.New("invalid order field")
+
+// ParcelPage страница посылок и общее количество посылок, подходящих под выборку
+type ParcelPage struct {
+	Parcels []Parcel
+	Total   int
+}
+
+// orderColumns поля, по которым можно сортировать страницы, и их столбцы.
+// Имя поля подставляется в запрос только через эту таблицу
+var orderColumns = map[string]string{
+	"number":     "{number}",
+	"client":     "{client}",
+	"status":     "{status}",
+	"address":    "{address}",
+	"created_at": "{created_at}",
+	"updated_at": "updated_at",
+	"priority":   "priority",
+}
+
+// orderClause строит ORDER BY по полю orderBy. Пустое поле — сортировка по номеру,
+// "-" перед именем — по убыванию. При равных значениях порядок задаёт номер,
+// чтобы страницы не пересекались
+func orderClause(orderBy string) (string, error) {
+	if orderBy == "" {
+		orderBy = "number"
+	}
+	dir := "ASC"
+	field := orderBy
+	if strings.HasPrefix(field, "-") {
+		dir = "DESC"
+		field = field[1:]
+	}
+
+	column, ok := orderColumns[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidOrder, orderBy)
+	}
+	if field == "number" {
+		return " ORDER BY {number} " + dir, nil
+	}
+
+	return " ORDER BY " + column + " " + dir + ", {number} " + dir, nil
+}
+
+// checkPage проверяет границы страницы
+func checkPage(limit, offset int) error {
+	if limit <= 0 {
+		return fmt.Errorf("page limit must be positive, got %d", limit)
+	}
+	if offset < 0 {
+		return fmt.Errorf("page offset must not be negative, got %d", offset)
+	}
+
+	return nil
+}
+
+// checkLimit проверяет количество посылок в выборках без смещения
+func checkLimit(limit int) error {
+	if limit <= 0 {
+		return fmt.Errorf("limit must be positive, got %d", limit)
+	}
+
+	return nil
+}
+
+// GetAllPage возвращает страницу всех посылок, отсортированных по orderBy (см. orderClause),
+// и их общее количество. Оба чтения выполняются в одной транзакции, поэтому Total
+// согласован со страницей. Предназначен для таблицы посылок в админке
+func (s ParcelStore) GetAllPage(limit, offset int, orderBy string) (ParcelPage, error) {
+	return s.getPage("", nil, limit, offset, orderBy)
+}
+
+// GetByStatusPage возвращает страницу посылок в статусе status, начиная с самых старых,
+// и общее количество посылок в этом статусе. Статус должен быть одним из известных
+func (s ParcelStore) GetByStatusPage(status string, limit, offset int) (ParcelPage, error) {
+	if _, ok := transitions[status]; !ok {
+		return ParcelPage{Parcels: []Parcel{}}, fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+
+	return s.getPage("{status} = ?", []any{status}, limit, offset, "created_at")
+}
+
+// getPage читает страницу посылок, подходящих под условие where, вместе с их количеством
+func (s ParcelStore) getPage(where string, args []any, limit, offset int, orderBy string) (ParcelPage, error) {
+	page := ParcelPage{Parcels: []Parcel{}}
+	if err := checkPage(limit, offset); err != nil {
+		return page, err
+	}
+	order, err := orderClause(orderBy)
+	if err != nil {
+		return page, err
+	}
+	if where != "" {
+		where = " WHERE " + where
+	}
+
+	tx, err := s.beginRead()
+	if err != nil {
+		return page, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow("SELECT COUNT(*) FROM parcel"+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	rows, err := tx.Query("SELECT "+parcelColumns+" FROM parcel"+where+order+" LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return page, err
+	}
+	parcels, err := collectRows(rows, scanParcelRows)
+	rows.Close()
+	if err != nil {
+		return page, err
+	}
+	page.Parcels = parcels
+
+	return page, tx.Commit()
+}
+
+// ParcelCursor перебирает все посылки в порядке номеров, загружая их страницами
+// по номеру последней прочитанной посылки: в памяти не больше одной страницы,
+// а между страницами соединение с БД не занято. Посылки, добавленные во время
+// перебора, попадут в него, если их номер больше текущего.
+// После цикла по Next нужно проверить Err
+type ParcelCursor struct {
+	s        ParcelStore
+	pageSize int
+	last     int
+	page     []Parcel
+	pos      int
+	done     bool
+	err      error
+}
+
+// Cursor возвращает курсор по всем посылкам со страницами по pageSize посылок.
+// Если pageSize не положительный, первый Next вернёт false, а Err — ошибку
+func (s ParcelStore) Cursor(pageSize int) *ParcelCursor {
+	c := &ParcelCursor{s: s, pageSize: pageSize, pos: -1}
+	if pageSize <= 0 {
+		c.err = fmt.Errorf("cursor page size must be positive, got %d", pageSize)
+		c.done = true
+	}
+
+	return c
+}
+
+// Next переходит к следующей посылке и при необходимости загружает следующую страницу.
+// Возвращает false, когда посылки закончились, произошла ошибка или курсор закрыт
+func (c *ParcelCursor) Next() bool {
+	if c.pos+1 < len(c.page) {
+		c.pos++
+		return true
+	}
+	if c.done {
+		c.page, c.pos = nil, -1
+		return false
+	}
+
+	page, err := queryAll(c.s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {number} > ? ORDER BY {number} LIMIT ?",
+		c.last, c.pageSize)
+	if err != nil {
+		c.err = err
+		c.done = true
+		c.page, c.pos = nil, -1
+		return false
+	}
+	// неполная страница — последняя
+	c.done = len(page) < c.pageSize
+	c.page, c.pos = page, 0
+	if len(page) == 0 {
+		c.pos = -1
+		return false
+	}
+	c.last = page[len(page)-1].Number
+
+	return true
+}
+
+// Parcel возвращает текущую посылку. До первого Next и после конца перебора
+// возвращает пустую посылку
+func (c *ParcelCursor) Parcel() Parcel {
+	if c.pos < 0 || c.pos >= len(c.page) {
+		return Parcel{}
+	}
+
+	return c.page[c.pos]
+}
+
+// Err возвращает ошибку, на которой остановился перебор, или nil
+func (c *ParcelCursor) Err() error {
+	return c.err
+}
+
+// Close завершает перебор и освобождает загруженную страницу. Повторный вызов безопасен
+func (c *ParcelCursor) Close() {
+	c.done = true
+	c.page, c.pos = nil, -1
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetAllPage проверяет постраничное чтение всех посылок
+func TestGetAllPage(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i, priority := range []int{2, 0, 2, 1} {
+		parcel := getTestParcel()
+		parcel.Client = 1000 + i
+		parcel.Priority = priority
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// по умолчанию — по номеру
+	page, err := store.GetAllPage(3, 0, "")
+	require.NoError(t, err)
+	require.Equal(t, 4, page.Total)
+	require.Len(t, page.Parcels, 3)
+	require.Equal(t, numbers[0], page.Parcels[0].Number)
+
+	// при равном приоритете порядок задаёт номер
+	page, err = store.GetAllPage(2, 1, "-priority")
+	require.NoError(t, err)
+	require.Equal(t, 4, page.Total)
+	require.Equal(t, []int{numbers[0], numbers[3]}, []int{page.Parcels[0].Number, page.Parcels[1].Number})
+
+	// за концом таблицы страница пустая
+	page, err = store.GetAllPage(2, 10, "created_at")
+	require.NoError(t, err)
+	require.Equal(t, 4, page.Total)
+	require.NotNil(t, page.Parcels)
+	require.Empty(t, page.Parcels)
+
+	// errors
+	_, err = store.GetAllPage(2, 0, "client; DROP TABLE parcel")
+	require.ErrorIs(t, err, ErrInvalidOrder)
+	_, err = store.GetAllPage(0, 0, "")
+	require.Error(t, err)
+	_, err = store.GetAllPage(2, -1, "")
+	require.Error(t, err)
+}
+
+// TestGetByStatusPage проверяет постраничное чтение посылок в одном статусе
+func TestGetByStatusPage(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var sent []int
+	for _, createdAt := range []string{"2024-06-03T10:00:00Z", "2024-06-01T10:00:00Z", "2024-06-02T10:00:00Z", "2024-06-01T09:00:00Z"} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		if createdAt != "2024-06-01T09:00:00Z" {
+			require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+			sent = append(sent, id)
+		}
+	}
+
+	// check: сначала самые старые
+	page, err := store.GetByStatusPage(ParcelStatusSent, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, page.Total)
+	require.Equal(t, []int{sent[1], sent[2]}, []int{page.Parcels[0].Number, page.Parcels[1].Number})
+
+	page, err = store.GetByStatusPage(ParcelStatusSent, 2, 2)
+	require.NoError(t, err)
+	require.Equal(t, 3, page.Total)
+	require.Len(t, page.Parcels, 1)
+	require.Equal(t, sent[0], page.Parcels[0].Number)
+
+	_, err = store.GetByStatusPage("shipped", 2, 0)
+	require.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+// TestCursor проверяет перебор всех посылок курсором по страницам
+func TestCursor(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 7; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// страницы по 3 и ровно по размеру таблицы
+	for _, size := range []int{3, 7, 100} {
+		c := store.Cursor(size)
+		got := []int{}
+		for c.Next() {
+			got = append(got, c.Parcel().Number)
+		}
+		require.NoError(t, c.Err())
+		require.Equal(t, numbers, got)
+		require.False(t, c.Next())
+		require.Zero(t, c.Parcel().Number)
+		c.Close()
+	}
+
+	// close
+	c := store.Cursor(3)
+	require.True(t, c.Next())
+	c.Close()
+	require.False(t, c.Next())
+	c.Close()
+
+	// empty
+	c = NewParcelStore(openTestDB(t)).Cursor(3)
+	require.False(t, c.Next())
+	require.NoError(t, c.Err())
+
+	// invalid
+	c = store.Cursor(0)
+	require.False(t, c.Next())
+	require.Error(t, c.Err())
+
+	c = NewParcelStore(nil).Cursor(3)
+	require.False(t, c.Next())
+	require.ErrorIs(t, c.Err(), ErrNoDatabase)
+}
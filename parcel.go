@@ -1,60 +1,1272 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
+var (
+	// ErrParcelNotMutable возвращается, если статус посылки не позволяет
+	// менять её адрес или удалять её
+	ErrParcelNotMutable = errors.New("parcel is not in registered status")
+	// ErrDuplicateParcel возвращается при нарушении уникальности посылки
+	ErrDuplicateParcel = errors.New("duplicate parcel")
+	// ErrInvalidParcel возвращается, если БД отклонила посылку из-за пустого
+	// обязательного поля (нарушение NOT NULL)
+	ErrInvalidParcel = errors.New("invalid parcel")
+	// ErrParcelNotFound возвращается, если посылки с таким номером нет.
+	// Ошибка оборачивает sql.ErrNoRows, так что проверка на неё тоже работает
+	ErrParcelNotFound = errors.New("parcel not found")
+	// ErrIDOverflow возвращается, если номер посылки не помещается в int
+	ErrIDOverflow = errors.New("parcel number overflows int")
+	// ErrStatusChanged возвращается, если статус посылки изменился с момента чтения
+	ErrStatusChanged = errors.New("parcel status has changed")
+	// ErrReadOnly возвращается изменяющими методами хранилища в режиме ReadOnly
+	ErrReadOnly = errors.New("parcel store is read-only")
+	// ErrNoDatabase возвращается методами хранилища, созданного без подключения к БД
+	ErrNoDatabase = errors.New("parcel store has no database")
+	// ErrInvalidPrefix возвращается, если префикс даты не YYYY, YYYY-MM или YYYY-MM-DD
+	ErrInvalidPrefix = errors.New("invalid created_at prefix")
+	// ErrInvalidPattern возвращается, если регулярное выражение для адреса не компилируется
+	ErrInvalidPattern = errors.New("invalid address pattern")
+)
+
+// createdPrefixRe допустимый префикс даты для GetByCreatedPrefix
+var createdPrefixRe = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+
+// mutableStatus статус, в котором посылку можно менять и удалять
+const mutableStatus = ParcelStatusRegistered
+
+// ParcelStore хранилище посылок в таблице parcel.
+// Методы, возвращающие срезы, при отсутствии строк возвращают пустой срез,
+// а не nil: в JSON он превращается в [], а не в null
 type ParcelStore struct {
-	db *sql.DB
+	db       *sql.DB
+	readDB   *sql.DB
+	cols     *strings.Replacer
+	err      error
+	history  bool
+	readOnly bool
+	clock    func() time.Time
+	carriers map[string]bool
+	events   chan<- ParcelEvent
+
+	explicitStatus  bool
+	deleteAnyStatus bool
+	clientStats     bool
+	retry           *RetryPolicy
+	mu              *sync.RWMutex
+	autoMigrate     *autoMigration
+	dialect         Dialect
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// StoreOption настраивает ParcelStore
+type StoreOption func(*ParcelStore)
+
+func NewParcelStore(db *sql.DB, opts ...StoreOption) ParcelStore {
+	s := ParcelStore{db: db}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	return s
+}
+
+// ReadOnly запрещает хранилищу любые изменения: изменяющие методы сразу,
+// не обращаясь к БД, возвращают ErrReadOnly. Чтение работает как обычно.
+// Подходит для сервисов отчётов, работающих с репликой
+func ReadOnly() StoreOption {
+	return func(s *ParcelStore) {
+		s.readOnly = true
+	}
+}
+
+// AllowExplicitStatusOnAdd разрешает Add и BatchAdd сохранять статус, указанный
+// в посылке, например при импорте уже отправленных посылок. Статус должен быть
+// одним из известных, пустой означает registered. Без опции новая посылка
+// всегда получает статус registered
+func AllowExplicitStatusOnAdd() StoreOption {
+	return func(s *ParcelStore) {
+		s.explicitStatus = true
+	}
+}
+
+// AllowDeleteAnyStatus снимает с Delete и DeleteMany ограничение статусом registered:
+// они удаляют посылки в любом статусе, как ForceDeleteMany. Нужна, если статусами
+// управляет внешняя система. Без опции удаляются только зарегистрированные посылки
+func AllowDeleteAnyStatus() StoreOption {
+	return func(s *ParcelStore) {
+		s.deleteAnyStatus = true
+	}
+}
+
+// WithAutoMigrate создаёт схему при первом обращении хранилища к БД: перед первым
+// запросом один раз выполняется InitSchema, а её ошибка возвращается этим и всеми
+// следующими методами. Удобно для утилит и тестов; в рабочих сервисах схемой
+// лучше управлять явно, поэтому по умолчанию опция выключена.
+// Вместе с ReadOnly опция ничего не делает: такое хранилище никогда не пишет в БД
+func WithAutoMigrate() StoreOption {
+	return func(s *ParcelStore) {
+		s.autoMigrate = &autoMigration{}
+	}
+}
+
+// autoMigration однократный запуск InitSchema. Хранится по указателю,
+// чтобы копии хранилища разделяли одну и ту же миграцию
+type autoMigration struct {
+	once sync.Once
+	err  error
+}
+
+// run выполняет InitSchema для db при первом вызове и возвращает её результат
+func (m *autoMigration) run(db *sql.DB) error {
+	m.once.Do(func() {
+		m.err = InitSchema(db)
+	})
+
+	return m.err
+}
+
+// WithReadDB направляет чтение (Get, GetByClient и другие запросы без изменений)
+// в отдельное подключение, например открытое только для чтения. Запись и
+// транзакции, которые читают перед записью, всегда идут в основное подключение.
+// Если readDB смотрит на реплику или другой процесс в режиме WAL, чтение может
+// не сразу увидеть только что записанные данные: после записи, результат которой
+// нужен немедленно, читайте через хранилище без этой опции
+func WithReadDB(readDB *sql.DB) StoreOption {
+	return func(s *ParcelStore) {
+		s.readDB = readDB
+	}
+}
+
+// WithClock задаёт источник текущего времени, например для тестов
+func WithClock(clock func() time.Time) StoreOption {
+	return func(s *ParcelStore) {
+		s.clock = clock
+	}
+}
+
+// now возвращает текущее время по часам хранилища
+func (s ParcelStore) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+
+	return s.clock()
+}
+
+// parcelColumns столбцы посылки в том порядке, в котором их читает scanParcel
+const parcelColumns = "{number}, {client}, {status}, {address}, {created_at}, updated_at, priority, carrier, notes, weight, length, width, height"
+
+// scanParcel читает посылку из строки, выбранной по parcelColumns.
+// extra получает значения столбцов, выбранных после столбцов посылки
+func scanParcel(r rowScanner, extra ...any) (Parcel, error) {
+	p := Parcel{}
+
+	// created_at может оказаться NULL в строках, пришедших из импорта,
+	// а в Postgres прийти как time.Time
+	var createdAt timestampText
+	dest := append([]any{&p.Number, &p.Client, &p.Status, &p.Address, &createdAt, &p.UpdatedAt, &p.Priority, &p.Carrier, &p.Notes, &p.Weight, &p.Length, &p.Width, &p.Height}, extra...)
+	if err := r.Scan(dest...); err != nil {
+		return p, err
+	}
+	p.CreatedAt = string(createdAt)
+
+	return p, nil
 }
 
-func NewParcelStore(db *sql.DB) ParcelStore {
-	return ParcelStore{db: db}
+// scanParcelRows читает посылку из текущей строки rows, см. queryAll
+func scanParcelRows(rows *sql.Rows) (Parcel, error) {
+	return scanParcel(rows)
+}
+
+// insertQuery добавляет посылку. Статус передаётся явно: обычно это registered,
+// а не статус из входной посылки (см. addStatus)
+const insertQuery = "INSERT INTO parcel ({client}, {status}, {address}, {created_at}, updated_at, priority, carrier, notes, weight, length, width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// insertNumber выполняет INSERT посылки в tx и возвращает её номер. lib/pq и pgx
+// не поддерживают LastInsertId, поэтому для Postgres номер читается через RETURNING
+func (s ParcelStore) insertNumber(ctx context.Context, tx storeTx, query string, args ...any) (int, error) {
+	if s.dialect == DialectPostgres {
+		var number int
+		if err := tx.QueryRowContext(ctx, query+" RETURNING {number}", args...).Scan(&number); err != nil {
+			return 0, s.classifyError(err)
+		}
+		return number, nil
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, s.classifyError(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return toInt(id)
+}
+
+// addStatus возвращает статус, с которым добавляется посылка p
+func (s ParcelStore) addStatus(p Parcel) (string, error) {
+	if !s.explicitStatus || p.Status == "" {
+		return ParcelStatusRegistered, nil
+	}
+	if _, ok := transitions[p.Status]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, p.Status)
+	}
+
+	return p.Status, nil
 }
 
 func (s ParcelStore) Add(p Parcel) (int, error) {
-	// реализуйте добавление строки в таблицу parcel, используйте данные из переменной p
+	if err := s.checkCarrier(p.Carrier); err != nil {
+		return 0, err
+	}
+	status, err := s.addStatus(p)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkNotes(p.Notes); err != nil {
+		return 0, err
+	}
+	if err := checkDimensions(p.Length, p.Width, p.Height); err != nil {
+		return 0, err
+	}
+
+	createdAt, err := s.createdAtArg(p.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	var number int
+	err = s.update(func(tx storeTx) error {
+		var err error
+		number, err = s.insertNumber(context.Background(), tx, insertQuery, p.Client, status, p.Address, createdAt, formatTime(s.now()), p.Priority, p.Carrier, p.Notes, p.Weight, p.Length, p.Width, p.Height)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.emit(ParcelEvent{Op: EventAdded, Number: number, Client: p.Client, Status: status, Address: p.Address})
+
+	return number, nil
+}
 
-	// верните идентификатор последней добавленной записи
-	return 0, nil
+// AddWithNumber добавляет посылку с номером, назначенным вызывающим, например
+// трек-номером внешней системы. Номер должен быть положительным, занятый номер
+// возвращает ErrDuplicateParcel. В остальном работает как Add
+func (s ParcelStore) AddWithNumber(number int, p Parcel) error {
+	if number <= 0 {
+		return fmt.Errorf("parcel number must be positive, got %d", number)
+	}
+	if err := s.checkCarrier(p.Carrier); err != nil {
+		return err
+	}
+	if err := checkNotes(p.Notes); err != nil {
+		return err
+	}
+	if err := checkDimensions(p.Length, p.Width, p.Height); err != nil {
+		return err
+	}
+	status, err := s.addStatus(p)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := s.createdAtArg(p.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec("INSERT INTO parcel ({number}, {client}, {status}, {address}, {created_at}, updated_at, priority, carrier, notes, weight, length, width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		number, p.Client, status, p.Address, createdAt, formatTime(s.now()), p.Priority, p.Carrier, p.Notes, p.Weight, p.Length, p.Width, p.Height)
+	if err != nil {
+		return s.classifyError(err)
+	}
+
+	s.emit(ParcelEvent{Op: EventAdded, Number: number, Client: p.Client, Status: status, Address: p.Address})
+
+	return nil
+}
+
+// Duplicate создаёт копию посылки для разделения отправления: с новым номером,
+// статусом registered и текущим временем создания. Возвращает номер копии
+func (s ParcelStore) Duplicate(number int) (int, error) {
+	var client, priority, copyNumber int
+	var address, carrier, notes string
+	var weight, length, width, height float64
+	err := s.update(func(tx storeTx) error {
+		err := tx.QueryRow("SELECT {client}, {address}, priority, carrier, notes, weight, length, width, height FROM parcel WHERE {number} = ?", number).
+			Scan(&client, &address, &priority, &carrier, &notes, &weight, &length, &width, &height)
+		if err != nil {
+			return notFound(err)
+		}
+
+		now := s.now()
+		copyNumber, err = s.insertNumber(context.Background(), tx, insertQuery, client, ParcelStatusRegistered, address, s.timeArg(now), formatTime(now), priority, carrier, notes, weight, length, width, height)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.emit(ParcelEvent{Op: EventAdded, Number: copyNumber, Client: client, Status: ParcelStatusRegistered, Address: address})
+
+	return copyNumber, nil
 }
 
 func (s ParcelStore) Get(number int) (Parcel, error) {
-	// реализуйте чтение строки по заданному number
-	// здесь из таблицы должна вернуться только одна строка
+	p, err := scanParcel(s.queryRow("SELECT "+parcelColumns+" FROM parcel WHERE {number} = ?", number))
+	if err != nil {
+		return p, notFound(err)
+	}
 
-	// заполните объект Parcel данными из таблицы
-	p := Parcel{}
+	return p, nil
+}
+
+// GetForUpdate читает посылку внутри транзакции tx (например, из RunInTx) и не даёт
+// другим подключениям менять данные до конца транзакции.
+// В SQLite блокировка действует на всю БД, а не на строку: перед чтением посылка
+// «изменяется» сама на себя, транзакция получает блокировку на запись, и другие
+// подключения не могут писать, пока она не завершится. В Postgres и MySQL
+// блокируется только строка посылки через SELECT ... FOR UPDATE.
+// Возвращает ErrParcelNotFound, если посылки нет
+func (s ParcelStore) GetForUpdate(tx *sql.Tx, number int) (Parcel, error) {
+	query := "SELECT " + parcelColumns + " FROM parcel WHERE {number} = ?"
+	if s.dialect == DialectPostgres || s.dialect == DialectMySQL {
+		query += " FOR UPDATE"
+	} else if _, err := tx.Exec(s.sqlText("UPDATE parcel SET {number} = {number} WHERE {number} = ?"), number); err != nil {
+		return Parcel{}, err
+	}
+
+	p, err := scanParcel(tx.QueryRow(s.sqlText(query), number))
+	if err != nil {
+		return p, notFound(err)
+	}
 
 	return p, nil
 }
 
 func (s ParcelStore) GetByClient(client int) ([]Parcel, error) {
-	// реализуйте чтение строк из таблицы parcel по заданному client
-	// здесь из таблицы может вернуться несколько строк
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {client} = ?", client)
+}
+
+// GetByClientRecent возвращает посылки клиента от новых к старым.
+// Посылки с одинаковым временем создания идут по убыванию номера,
+// поэтому порядок не меняется от запроса к запросу
+func (s ParcelStore) GetByClientRecent(client int) ([]Parcel, error) {
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {client} = ? ORDER BY {created_at} DESC, {number} DESC", client)
+}
+
+// GetByClientScroll возвращает до limit посылок клиента с номерами больше afterNumber
+// в порядке номеров и признак того, что за ними есть ещё. Для первой страницы
+// afterNumber равен 0, для следующей — номеру последней полученной посылки
+func (s ParcelStore) GetByClientScroll(client, afterNumber, limit int) ([]Parcel, bool, error) {
+	if limit <= 0 {
+		return nil, false, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+
+	// лишняя строка показывает, есть ли следующая страница, без отдельного COUNT
+	res, err := queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {client} = ? AND {number} > ? ORDER BY {number} LIMIT ?",
+		client, afterNumber, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res) > limit {
+		return res[:limit], true, nil
+	}
+
+	return res, false, nil
+}
+
+// GetByClientOrderedByAddress возвращает посылки клиента, упорядоченные по адресу,
+// а при одинаковом адресе — по номеру. Нужен для построения маршрута курьера
+func (s ParcelStore) GetByClientOrderedByAddress(client int) ([]Parcel, error) {
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {client} = ? ORDER BY {address}, {number}", client)
+}
+
+// parcelField столбец, из которого читается поле Parcel, и куда оно сканируется
+type parcelField struct {
+	column string
+	dest   func(p *Parcel) any
+}
+
+// parcelFields поля Parcel, которые можно запросить в GetByClientFields
+var parcelFields = map[string]parcelField{
+	"Number":    {"{number}", func(p *Parcel) any { return &p.Number }},
+	"Client":    {"{client}", func(p *Parcel) any { return &p.Client }},
+	"Status":    {"{status}", func(p *Parcel) any { return &p.Status }},
+	"Address":   {"{address}", func(p *Parcel) any { return &p.Address }},
+	"CreatedAt": {"{created_at}", func(p *Parcel) any { return (*timestampText)(&p.CreatedAt) }},
+	"UpdatedAt": {"updated_at", func(p *Parcel) any { return &p.UpdatedAt }},
+	"Priority":  {"priority", func(p *Parcel) any { return &p.Priority }},
+	"Carrier":   {"carrier", func(p *Parcel) any { return &p.Carrier }},
+	"Notes":     {"notes", func(p *Parcel) any { return &p.Notes }},
+	"Weight":    {"weight", func(p *Parcel) any { return &p.Weight }},
+	"Length":    {"length", func(p *Parcel) any { return &p.Length }},
+	"Width":     {"width", func(p *Parcel) any { return &p.Width }},
+	"Height":    {"height", func(p *Parcel) any { return &p.Height }},
+}
+
+// GetByClientFields возвращает посылки клиента, в которых заполнены только
+// перечисленные поля (имена полей Parcel, например "Number", "Status").
+// Остальные поля остаются нулевыми, а их столбцы не читаются
+func (s ParcelStore) GetByClientFields(client int, fields []string) ([]Parcel, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("no fields requested")
+	}
+
+	columns := make([]string, len(fields))
+	for i, name := range fields {
+		f, ok := parcelFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parcel field %q", name)
+		}
+		columns[i] = f.column
+	}
+
+	scan := func(rows *sql.Rows) (Parcel, error) {
+		p := Parcel{}
+		dest := make([]any, len(fields))
+		for i, name := range fields {
+			dest[i] = parcelFields[name].dest(&p)
+		}
+		err := rows.Scan(dest...)
+		return p, err
+	}
+
+	return queryAll(s, scan, "SELECT "+strings.Join(columns, ", ")+" FROM parcel WHERE {client} = ?", client)
+}
+
+// GetUpdatedSince возвращает посылки, изменённые начиная с момента t, в порядке изменения.
+// Для инкрементальной выгрузки в следующий раз стоит передать UpdatedAt последней посылки:
+// посылки с тем же временем придут повторно, но ни одна не потеряется
+func (s ParcelStore) GetUpdatedSince(t time.Time) ([]Parcel, error) {
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE updated_at >= ? ORDER BY updated_at, {number}",
+		formatTime(t))
+}
+
+// GetByCreatedPrefix возвращает посылки, созданные в указанный год, месяц или день,
+// например "2024", "2024-06" или "2024-06-01". Другие префиксы отклоняются с ErrInvalidPrefix,
+// чтобы символы шаблона LIKE не приводили к выборке всей таблицы
+func (s ParcelStore) GetByCreatedPrefix(prefix string) ([]Parcel, error) {
+	if !createdPrefixRe.MatchString(prefix) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPrefix, prefix)
+	}
+
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {created_at} LIKE ? || '%' ORDER BY {created_at}, {number}",
+		prefix)
+}
+
+// FindByAddressRegex возвращает посылки, адрес которых подходит под регулярное
+// выражение pattern (синтаксис пакета regexp), в порядке номеров.
+// Фильтрация идёт в Go, поэтому индекс не помогает: каждый вызов читает всю таблицу.
+// Для больших таблиц лучше сузить выборку другими методами
+func (s ParcelStore) FindByAddressRegex(pattern string) ([]Parcel, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPattern, err)
+	}
+
+	rows, err := s.query("SELECT " + parcelColumns + " FROM parcel ORDER BY {number}")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Parcel{}
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !re.MatchString(p.Address) {
+			continue
+		}
+		res = append(res, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Search ищет посылки для общего поля поиска: term совпадает с подстрокой адреса,
+// со статусом целиком или, если term — целое число, с номером посылки.
+// Символы шаблона LIKE в term ищутся буквально. Результат в порядке номеров,
+// пустой term ничего не находит
+func (s ParcelStore) Search(term string) ([]Parcel, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return []Parcel{}, nil
+	}
+
+	query := "SELECT " + parcelColumns + ` FROM parcel WHERE {address} LIKE '%' || ? || '%' ESCAPE '\' OR {status} = ?`
+	args := []any{escapeLike(term), term}
+	if number, err := strconv.Atoi(term); err == nil {
+		query += " OR {number} = ?"
+		args = append(args, number)
+	}
+
+	return queryAll(s, scanParcelRows, query+" ORDER BY {number}", args...)
+}
+
+// escapeLike экранирует символы шаблона LIKE для ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetNextToShip возвращает до limit зарегистрированных посылок в порядке отправки:
+// сначала с большим приоритетом, при равном приоритете — более старые
+func (s ParcelStore) GetNextToShip(limit int) ([]Parcel, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {status} = ? ORDER BY priority DESC, {created_at}, {number} LIMIT ?",
+		ParcelStatusRegistered, limit)
+}
+
+// SetPriority задаёт приоритет посылки. Приоритет можно менять в любом статусе
+func (s ParcelStore) SetPriority(number int, priority int) error {
+	res, err := s.exec("UPDATE parcel SET priority = ?, updated_at = ? WHERE {number} = ?",
+		priority, formatTime(s.now()), number)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
+
+	return nil
+}
+
+// maxNotesLength наибольшая длина заметок посылки в символах
+const maxNotesLength = 2000
+
+// ErrNotesTooLong возвращается, если заметки длиннее maxNotesLength символов
+var ErrNotesTooLong = errors.New("notes are too long")
+
+// checkNotes проверяет длину заметок
+func checkNotes(notes string) error {
+	if n := utf8.RuneCountInString(notes); n > maxNotesLength {
+		return fmt.Errorf("%w: %d characters, max %d", ErrNotesTooLong, n, maxNotesLength)
+	}
+
+	return nil
+}
 
-	// заполните срез Parcel данными из таблицы
-	var res []Parcel
+// SetNotes заменяет заметки службы поддержки к посылке. В отличие от адреса
+// заметки можно менять в любом статусе
+func (s ParcelStore) SetNotes(number int, notes string) error {
+	if err := checkNotes(notes); err != nil {
+		return err
+	}
+
+	res, err := s.exec("UPDATE parcel SET notes = ?, updated_at = ? WHERE {number} = ?",
+		notes, formatTime(s.now()), number)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
+
+	return nil
+}
+
+// GetStale возвращает зарегистрированные посылки, которые не отправлены дольше olderThan,
+// начиная с самых старых
+func (s ParcelStore) GetStale(olderThan time.Duration) ([]Parcel, error) {
+	cutoff := s.timeArg(s.now().Add(-olderThan))
+
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {status} = ? AND {created_at} < ? ORDER BY {created_at}, {number}",
+		ParcelStatusRegistered, cutoff)
+}
+
+// GetNeverShipped возвращает зарегистрированные посылки старше olderThan, статус
+// которых ни разу не менялся, начиная с самых старых. В отличие от GetStale
+// пропускает посылки, вернувшиеся в registered через Reactivate. Смены статуса
+// видны только по истории, поэтому без WithHistory выполняется GetStale
+// и таблица parcel_history не нужна.
+// Начальная запись истории из AddWithHistory сменой статуса не считается
+func (s ParcelStore) GetNeverShipped(olderThan time.Duration) ([]Parcel, error) {
+	if !s.history {
+		return s.GetStale(olderThan)
+	}
+
+	cutoff := s.timeArg(s.now().Add(-olderThan))
+
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+` FROM parcel
+		WHERE {status} = ? AND {created_at} < ?
+			AND NOT EXISTS (SELECT 1 FROM parcel_history h WHERE h.number = parcel.{number} AND h.from_status <> '')
+		ORDER BY {created_at}, {number}`,
+		ParcelStatusRegistered, cutoff)
+}
+
+// StuckInStatus возвращает посылки, которые сейчас в статусе status и перешли в него
+// раньше, чем longerThan назад по часам хранилища, в порядке номеров — например,
+// отправленные больше недели назад. Момент перехода берётся из последней записи
+// истории с этим статусом, а если её нет — из created_at. Без WithHistory так можно
+// оценить только registered, для остальных статусов возвращается ErrHistoryDisabled
+func (s ParcelStore) StuckInStatus(status string, longerThan time.Duration) ([]Parcel, error) {
+	if _, ok := transitions[status]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+	cutoff := s.now().Add(-longerThan)
+	if !s.history {
+		if status != ParcelStatusRegistered {
+			return nil, ErrHistoryDisabled
+		}
+		// без истории таблица parcel_history не читается
+		return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+" FROM parcel WHERE {status} = ? AND {created_at} < ? ORDER BY {number}",
+			status, s.timeArg(cutoff))
+	}
+
+	entered := "SELECT MAX(h.changed_at) FROM parcel_history h WHERE h.number = parcel.{number} AND h.to_status = parcel.{status}"
+
+	return queryAll(s, scanParcelRows, "SELECT "+parcelColumns+` FROM parcel
+		WHERE {status} = ? AND (
+			(`+entered+`) < ?
+			OR ((`+entered+`) IS NULL AND {created_at} < ?))
+		ORDER BY {number}`,
+		status, formatTime(cutoff), s.timeArg(cutoff))
+}
+
+// StreamByClient отправляет посылки клиента в канал по мере чтения из БД.
+// Оба канала закрываются по завершении, ошибка (в том числе ctx.Err()
+// при отмене контекста) приходит в канал ошибок не более одного раза
+func (s ParcelStore) StreamByClient(ctx context.Context, client int) (<-chan Parcel, <-chan error) {
+	out := make(chan Parcel)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		rows, err := s.queryContext(ctx, "SELECT "+parcelColumns+" FROM parcel WHERE {client} = ?", client)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			p, err := scanParcel(rows)
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case out <- p:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			errc <- err
+		}
+	}()
+
+	return out, errc
+}
+
+// EachParcel вызывает fn для каждой посылки таблицы в порядке номеров, не держа
+// в памяти больше одной строки. Останавливается на первой ошибке fn или при отмене
+// ctx и возвращает эту ошибку. Для выгрузки по частям достаточно запомнить номер
+// последней обработанной посылки
+func (s ParcelStore) EachParcel(ctx context.Context, fn func(Parcel) error) error {
+	rows, err := s.queryContext(ctx, "SELECT "+parcelColumns+" FROM parcel ORDER BY {number}")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p, err := scanParcel(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// StatusesOf возвращает статусы посылок из списка, читая только номер и статус.
+// Номеров, которых нет в таблице, в результате нет. Длинный список
+// запрашивается пачками, чтобы не превысить лимит параметров SQLite
+func (s ParcelStore) StatusesOf(numbers []int) (map[int]string, error) {
+	res := make(map[int]string, len(numbers))
+	for start := 0; start < len(numbers); start += maxParams {
+		chunk := numbers[start:min(start+maxParams, len(numbers))]
+
+		args := make([]any, len(chunk))
+		for i, number := range chunk {
+			args[i] = number
+		}
+
+		rows, err := s.query("SELECT {number}, {status} FROM parcel WHERE {number} IN ("+placeholders(len(chunk))+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var number int
+			var status string
+			if err := rows.Scan(&number, &status); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			res[number] = status
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// LatestPerClient возвращает самую свежую посылку каждого из клиентов.
+// Клиентов без посылок в результате нет. Длинный список клиентов читается
+// пачками по лимиту параметров SQLite
+func (s ParcelStore) LatestPerClient(clients []int) (map[int]Parcel, error) {
+	res := map[int]Parcel{}
+	if len(clients) == 0 {
+		return res, nil
+	}
+
+	for start := 0; start < len(clients); start += maxParams {
+		chunk := clients[start:min(start+maxParams, len(clients))]
+
+		args := make([]any, len(chunk))
+		for i, client := range chunk {
+			args[i] = client
+		}
+
+		rows, err := s.query(`SELECT `+parcelColumns+` FROM (
+			SELECT `+parcelColumns+`,
+				ROW_NUMBER() OVER (PARTITION BY {client} ORDER BY {created_at} DESC, {number} DESC) AS rn
+			FROM parcel WHERE {client} IN (`+placeholders(len(chunk))+`)
+		) WHERE rn = 1`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			p, err := scanParcel(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			res[p.Client] = p
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
 
 	return res, nil
 }
 
 func (s ParcelStore) SetStatus(number int, status string) error {
-	// реализуйте обновление статуса в таблице parcel
+	// статус меняется только по допустимому переходу
+	return s.changeStatus(number, status, "", false)
+}
+
+// SetStatusAndGet меняет статус посылки по тем же правилам, что и SetStatus,
+// и в той же транзакции читает посылку уже с новым статусом
+func (s ParcelStore) SetStatusAndGet(number int, status string) (Parcel, error) {
+	var current string
+	var p Parcel
+	err := s.update(func(tx storeTx) error {
+		var err error
+		current, err = s.changeStatusTx(tx, number, status, "", false)
+		if err != nil {
+			return err
+		}
+
+		p, err = scanParcel(tx.QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE {number} = ?", number))
+		return notFound(err)
+	})
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	s.emit(ParcelEvent{Op: EventStatusChanged, Number: number, PrevStatus: current, Status: status})
+
+	return p, nil
+}
+
+// EnsureStatus переводит посылку в статус status. Если посылка уже в нём,
+// ничего не делает, поэтому повторный вызов после сбоя безопасен
+func (s ParcelStore) EnsureStatus(number int, status string) error {
+	err := s.SetStatus(number, status)
+	if !errors.Is(err, ErrInvalidTransition) {
+		return err
+	}
+
+	// переход недопустим, но посылка могла уже оказаться в нужном статусе
+	p, getErr := s.Get(number)
+	if getErr == nil && p.Status == status {
+		return nil
+	}
+
+	return err
+}
+
+// MarkLost помечает отправленную посылку потерянной. Потерять можно только
+// посылку в статусе sent. Найденную посылку возвращает в работу Reactivate
+func (s ParcelStore) MarkLost(number int) error {
+	return s.changeStatus(number, ParcelStatusLost, "", false)
+}
+
+// Reactivate возвращает потерянную посылку в статус registered, чтобы её можно
+// было отправить заново, и снимает с неё отметку обработчика из ClaimNext.
+// Доставленную посылку вернуть нельзя
+func (s ParcelStore) Reactivate(number int) error {
+	return s.changeStatus(number, ParcelStatusRegistered, "", false)
+}
+
+// SetStatusIfCurrent меняет статус с expected на next, только если посылка всё ещё в статусе expected.
+// Если статус уже успел измениться, возвращает ErrStatusChanged
+func (s ParcelStore) SetStatusIfCurrent(number int, expected, next string) error {
+	if err := validateTransition(expected, next); err != nil {
+		return err
+	}
+
+	err := s.update(func(tx storeTx) error {
+		changedAt := formatTime(s.now())
+		res, err := tx.Exec("UPDATE parcel SET {status} = ?, updated_at = ? WHERE {number} = ? AND {status} = ?",
+			next, changedAt, number, expected)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// отличаем отсутствующую посылку от посылки в другом статусе
+			var exists bool
+			err := tx.QueryRow("SELECT COUNT(*) > 0 FROM parcel WHERE {number} = ?", number).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return ErrParcelNotFound
+			}
+			return ErrStatusChanged
+		}
+
+		if err := markDelivered(tx, number, next, changedAt); err != nil {
+			return err
+		}
+		if err := releaseOnRegistered(tx, number, next); err != nil {
+			return err
+		}
+		return s.recordHistory(tx, number, expected, next, "", changedAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.emit(ParcelEvent{Op: EventStatusChanged, Number: number, PrevStatus: expected, Status: next})
 
 	return nil
 }
 
+// IsMutable сообщает, позволяет ли статус посылки менять её адрес и удалять её
+func (s ParcelStore) IsMutable(number int) (bool, error) {
+	p, err := s.Get(number)
+	if err != nil {
+		return false, err
+	}
+
+	return isMutableStatus(p.Status), nil
+}
+
+// isMutableStatus проверяет, можно ли менять и удалять посылку с указанным статусом
+func isMutableStatus(status string) bool {
+	return status == mutableStatus
+}
+
+// SetAddress меняет адрес зарегистрированной посылки.
+// Если адрес совпадает с текущим, вызов ничего не меняет и успешен при любом статусе,
+// поэтому повтор запроса после сбоя безопасен. Если посылки нет, возвращает ErrParcelNotFound
 func (s ParcelStore) SetAddress(number int, address string) error {
-	// реализуйте обновление адреса в таблице parcel
 	// менять адрес можно только если значение статуса registered
+	res, err := s.exec("UPDATE parcel SET {address} = ?, updated_at = ? WHERE {number} = ? AND {status} = ? AND {address} <> ?",
+		address, formatTime(s.now()), number, mutableStatus, address)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var current string
+		err := s.queryRow("SELECT {address} FROM parcel WHERE {number} = ?", number).Scan(&current)
+		if err != nil {
+			return notFound(err)
+		}
+		if current == address {
+			return nil
+		}
+		return ErrParcelNotMutable
+	}
+
+	s.emit(ParcelEvent{Op: EventAddressChanged, Number: number, Address: address})
 
 	return nil
 }
 
+// SwapAddresses меняет местами адреса двух зарегистрированных посылок в одной транзакции.
+// Если какой-то посылки нет или она уже не в статусе registered, не меняется ни одна
+func (s ParcelStore) SwapAddresses(a, b int) error {
+	addresses := make(map[int]string, 2)
+	err := s.update(func(tx storeTx) error {
+		for _, number := range []int{a, b} {
+			var address, status string
+			err := tx.QueryRow("SELECT {address}, {status} FROM parcel WHERE {number} = ?", number).Scan(&address, &status)
+			if err != nil {
+				return notFound(err)
+			}
+			if !isMutableStatus(status) {
+				return fmt.Errorf("%w: parcel %d", ErrParcelNotMutable, number)
+			}
+			addresses[number] = address
+		}
+
+		now := formatTime(s.now())
+		for number, other := range map[int]int{a: b, b: a} {
+			_, err := tx.Exec("UPDATE parcel SET {address} = ?, updated_at = ? WHERE {number} = ?",
+				addresses[other], now, number)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.emit(ParcelEvent{Op: EventAddressChanged, Number: a, Address: addresses[b]})
+	s.emit(ParcelEvent{Op: EventAddressChanged, Number: b, Address: addresses[a]})
+
+	return nil
+}
+
+// SetAddresses меняет адреса нескольких зарегистрированных посылок (номер → новый адрес)
+// в одной транзакции и возвращает количество изменённых. Как и в SetAddress, запись
+// того же адреса ничего не меняет и допустима в любом статусе. Если какой-то посылки нет
+// или её адрес менять нельзя, не меняется ни одна
+func (s ParcelStore) SetAddresses(updates map[int]string) (int, error) {
+	if len(updates) == 0 {
+		return 0, nil
+	}
+
+	// посылки обрабатываются по возрастанию номера, чтобы ошибка не зависела от обхода карты
+	numbers := make([]int, 0, len(updates))
+	for number := range updates {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var changed []int
+	err := s.update(func(tx storeTx) error {
+		now := formatTime(s.now())
+		changed = []int{}
+		for _, number := range numbers {
+			var address, status string
+			err := tx.QueryRow("SELECT {address}, {status} FROM parcel WHERE {number} = ?", number).Scan(&address, &status)
+			if err != nil {
+				return notFound(err)
+			}
+			if address == updates[number] {
+				continue
+			}
+			if !isMutableStatus(status) {
+				return fmt.Errorf("%w: parcel %d", ErrParcelNotMutable, number)
+			}
+
+			_, err = tx.Exec("UPDATE parcel SET {address} = ?, updated_at = ? WHERE {number} = ?", updates[number], now, number)
+			if err != nil {
+				return err
+			}
+			changed = append(changed, number)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, number := range changed {
+		s.emit(ParcelEvent{Op: EventAddressChanged, Number: number, Address: updates[number]})
+	}
+
+	return len(changed), nil
+}
+
+// MergeClients переносит все посылки клиента from клиенту to при объединении учётных записей
+// и возвращает количество перенесённых. С WithClientStatsCache в той же транзакции кэш to
+// пересчитывается, как в RefreshClientStats, а кэш from удаляется
+func (s ParcelStore) MergeClients(from, to int) (int, error) {
+	if from == to {
+		return 0, nil
+	}
+
+	var moved int
+	err := s.update(func(tx storeTx) error {
+		res, err := tx.Exec("UPDATE parcel SET {client} = ?, updated_at = ? WHERE {client} = ?", to, formatTime(s.now()), from)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		moved = int(n)
+
+		if !s.clientStats {
+			return nil
+		}
+		if err := refreshClientStats(tx, to); err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM client_stats WHERE client = ?", from)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return moved, nil
+}
+
+// AnonymizedAddressPrefix начало адреса, которым AnonymizeClient заменяет адреса посылок
+const AnonymizedAddressPrefix = "anonymized #"
+
+// AnonymizeClient стирает персональные данные из посылок клиента по запросу на удаление:
+// адрес заменяется на AnonymizedAddressPrefix с номером посылки, примечания очищаются.
+// Номер в адресе нужен, чтобы посылки одного клиента с одинаковым created_at
+// не стали дубликатами для индекса WithUniqueParcels. Статусы, время, вес
+// и остальные столбцы для отчётов сохраняются, сами посылки не удаляются.
+// Возвращает количество изменённых посылок, поэтому повторный вызов возвращает 0.
+// События и история статусов не записываются
+func (s ParcelStore) AnonymizeClient(client int) (int, error) {
+	var anonymized int
+	err := s.update(func(tx storeTx) error {
+		res, err := tx.Exec(`UPDATE parcel SET {address} = ? || {number}, notes = '', updated_at = ?
+			WHERE {client} = ? AND ({address} <> ? || {number} OR notes <> '')`,
+			AnonymizedAddressPrefix, formatTime(s.now()), client, AnonymizedAddressPrefix)
+		if err != nil {
+			return s.classifyError(err)
+		}
+		n, err := res.RowsAffected()
+		anonymized = int(n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return anonymized, nil
+}
+
 func (s ParcelStore) Delete(number int) error {
-	// реализуйте удаление строки из таблицы parcel
+	query := "DELETE FROM parcel WHERE {number} = ?"
+	args := []any{number}
 	// удалять строку можно только если значение статуса registered
+	if !s.deleteAnyStatus {
+		query += " AND {status} = ?"
+		args = append(args, mutableStatus)
+	}
+
+	res, err := s.exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.emit(ParcelEvent{Op: EventDeleted, Number: number})
+	}
 
 	return nil
 }
+
+// DeleteMany удаляет в одной транзакции зарегистрированные посылки из списка
+// и возвращает количество удалённых. Посылки в других статусах остаются
+func (s ParcelStore) DeleteMany(numbers []int) (int, error) {
+	if s.deleteAnyStatus {
+		return s.ForceDeleteMany(numbers)
+	}
+
+	return s.deleteNumbers(numbers, " AND {status} = ?", mutableStatus)
+}
+
+// ForceDeleteMany удаляет посылки из списка независимо от их статуса.
+// Предназначен для администраторов
+func (s ParcelStore) ForceDeleteMany(numbers []int) (int, error) {
+	return s.deleteNumbers(numbers, "")
+}
+
+// deleteNumbers удаляет посылки из списка, подходящие под дополнительное условие cond,
+// и возвращает их количество. Список делится на пачки по лимиту параметров SQLite,
+// но все пачки удаляются в одной транзакции. Номера удалённых посылок нужны
+// для событий, поэтому удаление идёт через RETURNING
+func (s ParcelStore) deleteNumbers(numbers []int, cond string, condArgs ...any) (int, error) {
+	if len(numbers) == 0 {
+		return 0, nil
+	}
+
+	chunkSize := maxParams - len(condArgs)
+	var deleted []int
+	err := s.update(func(tx storeTx) error {
+		deleted = nil
+		for start := 0; start < len(numbers); start += chunkSize {
+			chunk := numbers[start:min(start+chunkSize, len(numbers))]
+
+			args := make([]any, 0, len(chunk)+len(condArgs))
+			for _, number := range chunk {
+				args = append(args, number)
+			}
+			args = append(args, condArgs...)
+
+			rows, err := tx.Query("DELETE FROM parcel WHERE {number} IN ("+placeholders(len(chunk))+")"+cond+" RETURNING {number}", args...)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var number int
+				if err := rows.Scan(&number); err != nil {
+					rows.Close()
+					return err
+				}
+				deleted = append(deleted, number)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, number := range deleted {
+		s.emit(ParcelEvent{Op: EventDeleted, Number: number})
+	}
+
+	return len(deleted), nil
+}
+
+// Truncate удаляет все посылки вместе с историей статусов, метками и кэшем статистики
+// клиентов и сбрасывает счётчик номеров, так что следующая добавленная посылка снова
+// получит номер 1 и не унаследует данные старой посылки с тем же номером. Нужен тестам,
+// которые работают с файловой БД. Рассчитан на SQLite
+func (s ParcelStore) Truncate() error {
+	return s.update(func(tx storeTx) error {
+		if _, err := tx.Exec("DELETE FROM parcel"); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"parcel_history", "parcel_tag", "client_stats", "sqlite_sequence"} {
+			exists, err := tableExists(tx, table)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				continue
+			}
+
+			query := "DELETE FROM " + table
+			if table == "sqlite_sequence" {
+				query += " WHERE name = 'parcel'"
+			}
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tableExists проверяет, есть ли в SQLite таблица name. Таблицы sqlite_sequence нет,
+// пока в БД нет ни одной таблицы с AUTOINCREMENT, например у унаследованных схем
+func tableExists(tx storeTx, name string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&exists)
+
+	return exists, err
+}
+
+// notFound заменяет sql.ErrNoRows на ErrParcelNotFound, сохраняя исходную ошибку в цепочке
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrParcelNotFound, err)
+	}
+
+	return err
+}
+
+// toInt приводит номер из БД к int. На 32-битных платформах
+// большой номер иначе молча обрезался бы
+func toInt(id int64) (int, error) {
+	if id > math.MaxInt || id < math.MinInt {
+		return 0, fmt.Errorf("%w: %d", ErrIDOverflow, id)
+	}
+
+	return int(id), nil
+}
+
+// placeholders возвращает список из n плейсхолдеров для IN (...)
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
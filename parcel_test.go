@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,60 +35,353 @@ func getTestParcel() Parcel {
 	}
 }
 
+// openTestDB открывает пустую БД в памяти с таблицей parcel.
+// Соединение одно, иначе каждое новое соединение получит свою пустую БД
+func openTestDB(t testing.TB, opts ...SchemaOption) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = InitSchema(db, opts...)
+	require.NoError(t, err)
+
+	return db
+}
+
+// TestAddWithNumber проверяет добавление посылки с заданным номером
+func TestAddWithNumber(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+
+	// add
+	err := store.AddWithNumber(5000, parcel)
+	require.NoError(t, err)
+
+	stored, err := store.Get(5000)
+	require.NoError(t, err)
+	require.Equal(t, parcel.Address, stored.Address)
+
+	// номер занят
+	err = store.AddWithNumber(5000, parcel)
+	require.ErrorIs(t, err, ErrDuplicateParcel)
+
+	// invalid number
+	err = store.AddWithNumber(0, parcel)
+	require.Error(t, err)
+
+	// автоматические номера продолжаются после заданного
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.Equal(t, 5001, id)
+}
+
+// TestParcelString проверяет формат посылки в логах
+func TestParcelString(t *testing.T) {
+	p := Parcel{Number: 42, Client: 1000, Status: ParcelStatusSent, Address: "test"}
+
+	require.Equal(t, "Parcel#42 client=1000 status=sent", p.String())
+	require.Equal(t, "Parcel#42 client=1000 status=sent", fmt.Sprintf("%v", p))
+}
+
+// fakeRow строка с заранее заданными значениями столбцов
+type fakeRow []any
+
+func (r fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r), len(dest))
+	}
+	for i, v := range r {
+		if err := convertAssign(dest[i], v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// convertAssign записывает v в dest так же, как это делает database/sql для простых типов
+func convertAssign(dest, v any) error {
+	switch d := dest.(type) {
+	case *int:
+		*d = v.(int)
+	case *string:
+		*d = v.(string)
+	case *float64:
+		*d = v.(float64)
+	case sql.Scanner:
+		return d.Scan(v)
+	default:
+		return fmt.Errorf("unsupported destination %T", dest)
+	}
+
+	return nil
+}
+
+// TestScanParcel проверяет порядок столбцов и обработку NULL в created_at
+func TestScanParcel(t *testing.T) {
+	row := fakeRow{7, 1000, ParcelStatusSent, "test", "2024-01-01T00:00:00Z", "2024-01-02T00:00:00Z", 3, "dhl", "хрупкое", 1.5, 30.0, 20.0, 10.0}
+	p, err := scanParcel(row)
+	require.NoError(t, err)
+	require.Equal(t, Parcel{
+		Number:    7,
+		Client:    1000,
+		Status:    ParcelStatusSent,
+		Address:   "test",
+		CreatedAt: "2024-01-01T00:00:00Z",
+		UpdatedAt: "2024-01-02T00:00:00Z",
+		Priority:  3,
+		Carrier:   "dhl",
+		Notes:     "хрупкое",
+		Weight:    1.5,
+		Length:    30,
+		Width:     20,
+		Height:    10,
+	}, p)
+
+	// NULL в created_at даёт пустую строку
+	row[4] = nil
+	p, err = scanParcel(row)
+	require.NoError(t, err)
+	require.Empty(t, p.CreatedAt)
+
+	// дополнительные столбцы идут после столбцов посылки
+	var tag string
+	_, err = scanParcel(append(row, "fragile"), &tag)
+	require.NoError(t, err)
+	require.Equal(t, "fragile", tag)
+
+	// ошибка чтения возвращается как есть
+	_, err = scanParcel(errRow{sql.ErrNoRows})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
 // TestAddGetDelete проверяет добавление, получение и удаление посылки
 func TestAddGetDelete(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := openTestDB(t)
 	store := NewParcelStore(db)
 	parcel := getTestParcel()
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NotZero(t, id)
 
 	// get
-	// получите только что добавленную посылку, убедитесь в отсутствии ошибки
-	// проверьте, что значения всех полей в полученном объекте совпадают со значениями полей в переменной parcel
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, id, stored.Number)
+	require.Equal(t, parcel.Client, stored.Client)
+	require.Equal(t, parcel.Status, stored.Status)
+	require.Equal(t, parcel.Address, stored.Address)
+	require.Equal(t, parcel.CreatedAt, stored.CreatedAt)
 
 	// delete
-	// удалите добавленную посылку, убедитесь в отсутствии ошибки
-	// проверьте, что посылку больше нельзя получить из БД
+	err = store.Delete(id)
+	require.NoError(t, err)
+
+	_, err = store.Get(id)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+	require.ErrorIs(t, err, sql.ErrNoRows)
 }
 
 // TestSetAddress проверяет обновление адреса
 func TestSetAddress(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := openTestDB(t)
+	store := NewParcelStore(db)
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotZero(t, id)
 
 	// set address
-	// обновите адрес, убедитесь в отсутствии ошибки
 	newAddress := "new test address"
+	err = store.SetAddress(id, newAddress)
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, newAddress, stored.Address)
+}
+
+// TestSetAddressSame проверяет, что запись того же адреса успешна при любом статусе
+func TestSetAddressSame(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	events := make(chan ParcelEvent, 10)
+	store := NewParcelStore(db, WithEventChannel(events))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	<-events
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	<-events
 
 	// check
-	// получите добавленную посылку и убедитесь, что адрес обновился
+	require.NoError(t, store.SetAddress(id, "test"))
+	require.ErrorIs(t, store.SetAddress(id, "new test address"), ErrParcelNotMutable)
+	require.ErrorIs(t, store.SetAddress(id+1, "test"), ErrParcelNotFound)
+	require.Empty(t, events)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "test", stored.Address)
+}
+
+// TestSetAddresses проверяет атомарную смену адресов нескольких посылок
+func TestSetAddresses(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	require.NoError(t, store.SetStatus(numbers[2], ParcelStatusSent))
+
+	// empty
+	n, err := store.SetAddresses(nil)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// ошибка в одной посылке отменяет все изменения
+	_, err = store.SetAddresses(map[int]string{numbers[0]: "a", numbers[2]: "c"})
+	require.ErrorIs(t, err, ErrParcelNotMutable)
+	_, err = store.SetAddresses(map[int]string{numbers[0]: "a", numbers[2] + 1: "c"})
+	require.ErrorIs(t, err, ErrParcelNotFound)
+	stored, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, "test", stored.Address)
+
+	// set: тот же адрес отправленной посылки изменением не считается
+	n, err = store.SetAddresses(map[int]string{numbers[0]: "a", numbers[1]: "b", numbers[2]: "test"})
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	for i, want := range []string{"a", "b", "test"} {
+		stored, err := store.Get(numbers[i])
+		require.NoError(t, err)
+		require.Equal(t, want, stored.Address)
+	}
+}
+
+// TestMergeClients проверяет перенос посылок и кэша статистики другому клиенту
+func TestMergeClients(t *testing.T) {
+	// prepare
+	db := openTestDB(t, WithClientStats())
+	store := NewParcelStore(db, WithClientStatsCache())
+
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Client = 1000 + i%2
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+	// кэш пересчитан только у переносимого клиента
+	require.NoError(t, store.RefreshClientStats(1001))
+
+	// merge
+	n, err := store.MergeClients(1001, 1000)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 3)
+
+	stats, err := store.GetClientStats(1000)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{ParcelStatusRegistered: 3}, stats)
+	stats, err = store.GetClientStats(1001)
+	require.NoError(t, err)
+	require.Empty(t, stats)
+
+	// без WithClientStatsCache переносятся только посылки
+	plain := NewParcelStore(openTestDB(t))
+	_, err = plain.Add(getTestParcel())
+	require.NoError(t, err)
+	n, err = plain.MergeClients(1000, 1002)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
 }
 
 // TestSetStatus проверяет обновление статуса
 func TestSetStatus(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := openTestDB(t)
+	store := NewParcelStore(db)
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotZero(t, id)
 
 	// set status
-	// обновите статус, убедитесь в отсутствии ошибки
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
 
 	// check
-	// получите добавленную посылку и убедитесь, что статус обновился
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+}
+
+// TestGetForUpdate проверяет, что после GetForUpdate другие подключения не могут писать до конца транзакции
+func TestGetForUpdate(t *testing.T) {
+	// prepare: два подключения к одному файлу БД
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, InitSchema(db))
+	other, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { other.Close() })
+
+	store := NewParcelStore(db)
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// lock
+	err = store.RunInTx(nil, func(tx *sql.Tx) error {
+		p, err := store.GetForUpdate(tx, id)
+		if err != nil {
+			return err
+		}
+		require.Equal(t, id, p.Number)
+
+		// запись из другого подключения упирается в блокировку
+		_, err = other.Exec("UPDATE parcel SET address = 'other' WHERE number = ?", id)
+		require.Error(t, err)
+
+		_, err = store.GetForUpdate(tx, id+1)
+		require.ErrorIs(t, err, ErrParcelNotFound)
+
+		_, err = tx.Exec("UPDATE parcel SET address = 'locked' WHERE number = ?", id)
+		return err
+	})
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "locked", stored.Address)
 }
 
 // TestGetByClient проверяет получение посылок по идентификатору клиента
 func TestGetByClient(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := openTestDB(t)
+	store := NewParcelStore(db)
 
 	parcels := []Parcel{
 		getTestParcel(),
@@ -98,7 +398,9 @@ func TestGetByClient(t *testing.T) {
 
 	// add
 	for i := 0; i < len(parcels); i++ {
-		id, err := // добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+		id, err := store.Add(parcels[i])
+		require.NoError(t, err)
+		require.NotZero(t, id)
 
 		// обновляем идентификатор добавленной у посылки
 		parcels[i].Number = id
@@ -108,14 +410,1352 @@ func TestGetByClient(t *testing.T) {
 	}
 
 	// get by client
-	storedParcels, err := // получите список посылок по идентификатору клиента, сохранённого в переменной client
-	// убедитесь в отсутствии ошибки
-	// убедитесь, что количество полученных посылок совпадает с количеством добавленных
+	storedParcels, err := store.GetByClient(client)
+	require.NoError(t, err)
+	require.Len(t, storedParcels, len(parcels))
 
 	// check
 	for _, parcel := range storedParcels {
 		// в parcelMap лежат добавленные посылки, ключ - идентификатор посылки, значение - сама посылка
-		// убедитесь, что все посылки из storedParcels есть в parcelMap
-		// убедитесь, что значения полей полученных посылок заполнены верно
+		expected, ok := parcelMap[parcel.Number]
+		require.True(t, ok)
+		require.Equal(t, expected.Client, parcel.Client)
+		require.Equal(t, expected.Status, parcel.Status)
+		require.Equal(t, expected.Address, parcel.Address)
+		require.Equal(t, expected.CreatedAt, parcel.CreatedAt)
+	}
+}
+
+// TestGetByClientRecent проверяет порядок посылок от новых к старым
+func TestGetByClientRecent(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for _, createdAt := range []string{"2024-01-01T00:00:00Z", "2024-03-01T00:00:00Z", "2024-03-01T00:00:00Z", "2024-02-01T00:00:00Z"} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// get
+	stored, err := store.GetByClientRecent(getTestParcel().Client)
+	require.NoError(t, err)
+
+	// check
+	var got []int
+	for _, p := range stored {
+		got = append(got, p.Number)
+	}
+	require.Equal(t, []int{numbers[2], numbers[1], numbers[3], numbers[0]}, got)
+}
+
+// TestGetByClientScroll проверяет постраничное чтение с признаком продолжения
+func TestGetByClientScroll(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 5; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// scroll
+	var got []int
+	after, pages := 0, 0
+	for {
+		page, hasMore, err := store.GetByClientScroll(getTestParcel().Client, after, 2)
+		require.NoError(t, err)
+		pages++
+		for _, p := range page {
+			got = append(got, p.Number)
+		}
+		if !hasMore {
+			break
+		}
+		after = page[len(page)-1].Number
+	}
+
+	// check
+	require.Equal(t, numbers, got)
+	require.Equal(t, 3, pages)
+
+	// ровно limit посылок — продолжения нет
+	page, hasMore, err := store.GetByClientScroll(getTestParcel().Client, numbers[2], 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	require.False(t, hasMore)
+
+	_, _, err = store.GetByClientScroll(getTestParcel().Client, 0, 0)
+	require.Error(t, err)
+}
+
+// TestGetByClientOrderedByAddress проверяет порядок посылок по адресу и номеру
+func TestGetByClientOrderedByAddress(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for _, address := range []string{"ул. Садовая, 5", "ул. Ленина, 1", "ул. Садовая, 5", "пр. Мира, 3"} {
+		parcel := getTestParcel()
+		parcel.Address = address
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// get
+	stored, err := store.GetByClientOrderedByAddress(getTestParcel().Client)
+	require.NoError(t, err)
+
+	// check
+	var got []int
+	for _, p := range stored {
+		got = append(got, p.Number)
+	}
+	require.Equal(t, []int{numbers[3], numbers[1], numbers[0], numbers[2]}, got)
+}
+
+// TestGetByClientFields проверяет, что заполняются только запрошенные поля
+func TestGetByClientFields(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// get
+	stored, err := store.GetByClientFields(parcel.Client, []string{"Number", "Status", "CreatedAt"})
+	require.NoError(t, err)
+	require.Equal(t, []Parcel{{Number: id, Status: ParcelStatusRegistered, CreatedAt: parcel.CreatedAt}}, stored)
+
+	// unknown field
+	_, err = store.GetByClientFields(parcel.Client, []string{"Number", "number; DROP TABLE parcel"})
+	require.Error(t, err)
+	_, err = store.GetByClientFields(parcel.Client, nil)
+	require.Error(t, err)
+}
+
+// TestIsMutable проверяет, что менять и удалять можно только зарегистрированную посылку
+func TestIsMutable(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// registered
+	mutable, err := store.IsMutable(id)
+	require.NoError(t, err)
+	require.True(t, mutable)
+
+	// sent
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	mutable, err = store.IsMutable(id)
+	require.NoError(t, err)
+	require.False(t, mutable)
+
+	// адрес и сама посылка не должны измениться
+	err = store.SetAddress(id, "new test address")
+	require.ErrorIs(t, err, ErrParcelNotMutable)
+
+	err = store.Delete(id)
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "test", stored.Address)
+}
+
+// TestLatestPerClient проверяет получение последней посылки каждого клиента
+func TestLatestPerClient(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	old := getTestParcel()
+	old.CreatedAt = "2024-01-01T10:00:00Z"
+	latest := getTestParcel()
+	latest.CreatedAt = "2024-02-01T10:00:00Z"
+	latest.Address = "latest"
+	other := getTestParcel()
+	other.Client = 2000
+
+	// add
+	_, err := store.Add(latest)
+	require.NoError(t, err)
+	_, err = store.Add(old)
+	require.NoError(t, err)
+	otherID, err := store.Add(other)
+	require.NoError(t, err)
+
+	// check
+	res, err := store.LatestPerClient([]int{1000, 2000, 3000})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, "latest", res[1000].Address)
+	require.Equal(t, otherID, res[2000].Number)
+
+	// список длиннее лимита параметров SQLite
+	clients := make([]int, 0, 3000)
+	for client := 3000; len(clients) < cap(clients)-1; client++ {
+		clients = append(clients, client)
+	}
+	clients = append(clients, 2000)
+	res, err = store.LatestPerClient(clients)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, otherID, res[2000].Number)
+
+	res, err = store.LatestPerClient(nil)
+	require.NoError(t, err)
+	require.Empty(t, res)
+}
+
+// TestGetNullCreatedAt проверяет чтение посылки с NULL в created_at
+func TestGetNullCreatedAt(t *testing.T) {
+	// prepare
+	// в таблицах из старых импортов на created_at нет ограничения NOT NULL
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE parcel (
+		number     INTEGER PRIMARY KEY AUTOINCREMENT,
+		client     INTEGER NOT NULL,
+		status     TEXT    NOT NULL,
+		address    TEXT    NOT NULL,
+		created_at TEXT
+	)`)
+	require.NoError(t, err)
+	require.NoError(t, Migrate(db))
+
+	res, err := db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (?, ?, ?, NULL)",
+		1000, ParcelStatusRegistered, "test")
+	require.NoError(t, err)
+	id, err := res.LastInsertId()
+	require.NoError(t, err)
+
+	store := NewParcelStore(db)
+
+	// get
+	stored, err := store.Get(int(id))
+	require.NoError(t, err)
+	require.Equal(t, "", stored.CreatedAt)
+
+	// get by client
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, "", parcels[0].CreatedAt)
+
+	// выборочные поля читают created_at так же, как scanParcel
+	parcels, err = store.GetByClientFields(1000, []string{"Number", "CreatedAt"})
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, "", parcels[0].CreatedAt)
+}
+
+// TestStreamByClient проверяет потоковое чтение посылок клиента
+func TestStreamByClient(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for i := 0; i < 3; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// stream
+	out, errc := store.StreamByClient(context.Background(), 1000)
+	var parcels []Parcel
+	for p := range out {
+		parcels = append(parcels, p)
+	}
+	require.NoError(t, <-errc)
+	require.Len(t, parcels, 3)
+
+	// cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	out, errc = store.StreamByClient(ctx, 1000)
+	<-out
+	cancel()
+	require.ErrorIs(t, <-errc, context.Canceled)
+	for range out {
+	}
+}
+
+// TestSetStatusInvalidTransition проверяет, что статус меняется только по допустимому переходу
+func TestSetStatusInvalidTransition(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set status
+	err = store.SetStatus(id, ParcelStatusDelivered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+}
+
+// TestStatusesOf проверяет получение статусов по списку номеров
+func TestStatusesOf(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	require.NoError(t, store.SetStatus(numbers[1], ParcelStatusSent))
+
+	// statuses: список длиннее лимита параметров, с отсутствующими номерами
+	query := append([]int{}, numbers...)
+	for i := 0; i < maxParams; i++ {
+		query = append(query, numbers[2]+1+i)
+	}
+	statuses, err := store.StatusesOf(query)
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{
+		numbers[0]: ParcelStatusRegistered,
+		numbers[1]: ParcelStatusSent,
+		numbers[2]: ParcelStatusRegistered,
+	}, statuses)
+
+	statuses, err = store.StatusesOf(nil)
+	require.NoError(t, err)
+	require.Empty(t, statuses)
+}
+
+// TestEachParcel проверяет обход всей таблицы, остановку по ошибке и отмену контекста
+func TestEachParcel(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Client = 1000 + i
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// each
+	var got []int
+	err := store.EachParcel(context.Background(), func(p Parcel) error {
+		got = append(got, p.Number)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, numbers, got)
+
+	// ошибка fn останавливает обход
+	errStop := errors.New("stop")
+	got = nil
+	err = store.EachParcel(context.Background(), func(p Parcel) error {
+		got = append(got, p.Number)
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Len(t, got, 1)
+
+	// cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	got = nil
+	err = store.EachParcel(ctx, func(p Parcel) error {
+		got = append(got, p.Number)
+		cancel()
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, got, 1)
+}
+
+// TestDeleteMany проверяет массовое удаление с учётом статуса
+func TestDeleteMany(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	err := store.SetStatus(numbers[0], ParcelStatusSent)
+	require.NoError(t, err)
+
+	// delete
+	n, err := store.DeleteMany(numbers)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	_, err = store.Get(numbers[0])
+	require.NoError(t, err)
+
+	// force delete
+	n, err = store.ForceDeleteMany(numbers)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// empty
+	n, err = store.DeleteMany(nil)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// список длиннее лимита параметров SQLite
+	parcels := make([]Parcel, 1500)
+	for i := range parcels {
+		parcels[i] = getTestParcel()
+	}
+	ids, err := store.BatchAdd(parcels)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(ids[len(ids)-1], ParcelStatusSent))
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, ids[len(ids)-1]+1000+i)
+	}
+
+	n, err = store.DeleteMany(ids)
+	require.NoError(t, err)
+	require.Equal(t, 1499, n)
+	n, err = store.ForceDeleteMany(ids)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+// TestAllowDeleteAnyStatus проверяет удаление посылок в любом статусе
+func TestAllowDeleteAnyStatus(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	guarded := NewParcelStore(db)
+	store := NewParcelStore(db, AllowDeleteAnyStatus())
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		numbers = append(numbers, id)
+	}
+
+	// без опции отправленная посылка остаётся
+	require.NoError(t, guarded.Delete(numbers[0]))
+	_, err := store.Get(numbers[0])
+	require.NoError(t, err)
+
+	// delete
+	require.NoError(t, store.Delete(numbers[0]))
+	_, err = store.Get(numbers[0])
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	n, err := store.DeleteMany(numbers)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+// TestTruncate проверяет удаление всех посылок и сброс счётчика номеров
+func TestTruncate(t *testing.T) {
+	// prepare
+	db := openTestDB(t, WithClientStats())
+	store := NewParcelStore(db)
+
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		require.NoError(t, store.AddTag(id, "fragile"))
+		require.NoError(t, NewParcelStore(db, WithHistory()).SetStatus(id, ParcelStatusSent))
+	}
+	require.NoError(t, store.RefreshClientStats(getTestParcel().Client))
+
+	// truncate
+	err := store.Truncate()
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.GetByClient(getTestParcel().Client)
+	require.NoError(t, err)
+	require.Empty(t, stored)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Equal(t, 1, id)
+
+	// новая посылка с тем же номером не наследует метки и историю
+	tags, err := store.GetTags(id)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+	history, err := store.GetHistory(id)
+	require.NoError(t, err)
+	require.Empty(t, history)
+	counts, err := store.GetClientStats(getTestParcel().Client)
+	require.NoError(t, err)
+	require.Empty(t, counts)
+
+	// хранилище только для чтения не очищается
+	err = NewParcelStore(db, ReadOnly()).Truncate()
+	require.ErrorIs(t, err, ErrReadOnly)
+}
+
+// TestTruncateWithoutAutoincrement проверяет очистку таблицы без AUTOINCREMENT,
+// для которой SQLite не создаёт sqlite_sequence
+func TestTruncateWithoutAutoincrement(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE parcel (
+		id       INTEGER PRIMARY KEY,
+		customer INTEGER NOT NULL,
+		state    TEXT    NOT NULL,
+		addr     TEXT    NOT NULL,
+		ts       TEXT    NOT NULL
+	)`)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO parcel (customer, state, addr, ts) VALUES (1000, 'registered', 'test', '')")
+	require.NoError(t, err)
+
+	// truncate: без миграций нет ни sqlite_sequence, ни истории, ни меток
+	require.NoError(t, NewParcelStore(db, WithColumns(legacyColumns)).Truncate())
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM parcel").Scan(&count))
+	require.Zero(t, count)
+}
+
+// TestToInt проверяет приведение номера из БД к int. Номера за пределами int32
+// переполняют int только на 32-битных платформах, например при GOARCH=386
+func TestToInt(t *testing.T) {
+	tests := []struct {
+		id       int64
+		overflow bool
+	}{
+		{0, false},
+		{1, false},
+		{math.MaxInt32, false},
+		{math.MinInt32, false},
+		{math.MaxInt32 + 1, strconv.IntSize == 32},
+		{math.MinInt32 - 1, strconv.IntSize == 32},
+		{math.MaxInt64, strconv.IntSize == 32},
+	}
+	for _, tt := range tests {
+		got, err := toInt(tt.id)
+		if tt.overflow {
+			require.ErrorIs(t, err, ErrIDOverflow, tt.id)
+			continue
+		}
+		require.NoError(t, err, tt.id)
+		require.Equal(t, tt.id, int64(got))
+	}
+}
+
+// TestAllowExplicitStatusOnAdd проверяет сохранение статуса из входной посылки
+func TestAllowExplicitStatusOnAdd(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	parcel := getTestParcel()
+	parcel.Status = ParcelStatusSent
+
+	// по умолчанию статус всегда registered
+	id, err := NewParcelStore(db).Add(parcel)
+	require.NoError(t, err)
+	stored, err := NewParcelStore(db).Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+
+	// explicit status
+	store := NewParcelStore(db, AllowExplicitStatusOnAdd())
+	id, err = store.Add(parcel)
+	require.NoError(t, err)
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+
+	parcel.Status = "shipped"
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+// TestSetStatusAndGet проверяет, что возвращается посылка с новым статусом
+func TestSetStatusAndGet(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithClock(func() time.Time { return now }))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set
+	p, err := store.SetStatusAndGet(id, ParcelStatusSent)
+	require.NoError(t, err)
+	require.Equal(t, id, p.Number)
+	require.Equal(t, ParcelStatusSent, p.Status)
+	require.Equal(t, formatTime(now), p.UpdatedAt)
+
+	// errors
+	_, err = store.SetStatusAndGet(id, ParcelStatusRegistered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+	_, err = store.SetStatusAndGet(id+1, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestEnsureStatus проверяет, что повторная установка того же статуса не приводит к ошибке
+func TestEnsureStatus(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// ensure
+	err = store.EnsureStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.EnsureStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// недопустимый переход по-прежнему запрещён
+	err = store.EnsureStatus(id, ParcelStatusRegistered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+}
+
+// TestSetNotes проверяет изменение заметок в любом статусе и ограничение длины
+func TestSetNotes(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	parcel := getTestParcel()
+	parcel.Notes = "позвонить заранее"
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "позвонить заранее", stored.Notes)
+
+	// заметки меняются и у отправленной посылки
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	err = store.SetNotes(id, "клиент просил оставить у двери")
+	require.NoError(t, err)
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "клиент просил оставить у двери", stored.Notes)
+
+	// limits
+	err = store.SetNotes(id, strings.Repeat("я", maxNotesLength))
+	require.NoError(t, err)
+	err = store.SetNotes(id, strings.Repeat("я", maxNotesLength+1))
+	require.ErrorIs(t, err, ErrNotesTooLong)
+
+	parcel.Notes = strings.Repeat("я", maxNotesLength+1)
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrNotesTooLong)
+
+	err = store.SetNotes(id+1, "")
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestGetStale проверяет получение давно не отправленных посылок
+func TestGetStale(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithClock(func() time.Time { return now }))
+
+	var numbers []int
+	for _, createdAt := range []string{
+		"2024-06-10T06:00:00Z",
+		"2024-06-09T06:00:00Z",
+		"2024-06-10T11:00:00Z",
+		"2024-06-08T06:00:00Z",
+	} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// отправленная посылка не считается зависшей
+	err := store.SetStatus(numbers[1], ParcelStatusSent)
+	require.NoError(t, err)
+
+	// check
+	stale, err := store.GetStale(4 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stale, 2)
+	require.Equal(t, numbers[3], stale[0].Number)
+	require.Equal(t, numbers[0], stale[1].Number)
+}
+
+// TestGetNeverShipped проверяет, что посылки, уже менявшие статус, не попадают в выборку
+func TestGetNeverShipped(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithHistory(), WithClock(func() time.Time { return now }))
+
+	var numbers []int
+	for _, createdAt := range []string{
+		"2024-06-08T06:00:00Z",
+		"2024-06-09T06:00:00Z",
+		"2024-06-10T11:00:00Z",
+	} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// посылка потерялась и вернулась в registered
+	require.NoError(t, store.SetStatus(numbers[1], ParcelStatusSent))
+	require.NoError(t, store.MarkLost(numbers[1]))
+	require.NoError(t, store.Reactivate(numbers[1]))
+
+	// check
+	stale, err := store.GetStale(4 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stale, 2)
+
+	never, err := store.GetNeverShipped(4 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, never, 1)
+	require.Equal(t, numbers[0], never[0].Number)
+
+	// без истории таблица parcel_history не читается
+	_, err = db.Exec("DROP TABLE parcel_history")
+	require.NoError(t, err)
+	never, err = NewParcelStore(db, WithClock(func() time.Time { return now })).GetNeverShipped(4 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, never, 2)
+}
+
+// TestStuckInStatus проверяет поиск посылок, слишком долго остающихся в статусе
+func TestStuckInStatus(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithHistory(), WithClock(func() time.Time { return now }))
+
+	var numbers []int
+	for i := 0; i < 4; i++ {
+		parcel := getTestParcel()
+		parcel.CreatedAt = "2024-06-01T12:00:00Z"
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// numbers[0] отправлена 8 дней назад, numbers[1] — 2 дня назад
+	now = time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SetStatus(numbers[0], ParcelStatusSent))
+	// numbers[2] потеряна и возвращена в registered 2 дня назад
+	require.NoError(t, store.SetStatus(numbers[2], ParcelStatusSent))
+	require.NoError(t, store.MarkLost(numbers[2]))
+	now = time.Date(2024, 6, 8, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SetStatus(numbers[1], ParcelStatusSent))
+	require.NoError(t, store.Reactivate(numbers[2]))
+	now = time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	// check
+	stuck, err := store.StuckInStatus(ParcelStatusSent, 7*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+	require.Equal(t, numbers[0], stuck[0].Number)
+
+	stuck, err = store.StuckInStatus(ParcelStatusRegistered, 7*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+	require.Equal(t, numbers[3], stuck[0].Number)
+
+	stuck, err = store.StuckInStatus(ParcelStatusRegistered, 24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stuck, 2)
+
+	// без истории registered оценивается по created_at, таблица истории не нужна
+	_, err = db.Exec("DROP TABLE parcel_history")
+	require.NoError(t, err)
+	plain := NewParcelStore(db, WithClock(func() time.Time { return now }))
+	stuck, err = plain.StuckInStatus(ParcelStatusRegistered, 7*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stuck, 2)
+	_, err = plain.StuckInStatus(ParcelStatusSent, time.Hour)
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+	_, err = plain.StuckInStatus("unknown", time.Hour)
+	require.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+// TestGetUpdatedSince проверяет получение посылок, изменённых после заданного момента
+func TestGetUpdatedSince(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithClock(func() time.Time { return now }))
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// update
+	now = now.Add(time.Hour)
+	err = store.SetStatus(first, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// check
+	parcels, err := store.GetUpdatedSince(now)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, first, parcels[0].Number)
+	require.Equal(t, formatTime(now), parcels[0].UpdatedAt)
+
+	parcels, err = store.GetUpdatedSince(now.Add(-2 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, second, parcels[0].Number)
+	require.Equal(t, first, parcels[1].Number)
+}
+
+// TestSetStatusIfCurrent проверяет смену статуса только из ожидаемого
+func TestSetStatusIfCurrent(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set status
+	err = store.SetStatusIfCurrent(id, ParcelStatusRegistered, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// второй воркер ещё думает, что посылка зарегистрирована
+	err = store.SetStatusIfCurrent(id, ParcelStatusRegistered, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrStatusChanged)
+
+	err = store.SetStatusIfCurrent(id+1, ParcelStatusRegistered, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+}
+
+// TestDuplicate проверяет создание копии посылки
+func TestDuplicate(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithClock(func() time.Time { return now }))
+
+	parcel := getTestParcel()
+	parcel.CreatedAt = "2024-06-01T10:00:00Z"
+	parcel.Weight = 2.5
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// duplicate
+	copyID, err := store.Duplicate(id)
+	require.NoError(t, err)
+	require.NotEqual(t, id, copyID)
+
+	// check
+	stored, err := store.Get(copyID)
+	require.NoError(t, err)
+	require.Equal(t, parcel.Client, stored.Client)
+	require.Equal(t, parcel.Address, stored.Address)
+	require.Equal(t, parcel.Weight, stored.Weight)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+	require.Equal(t, formatTime(now), stored.CreatedAt)
+
+	// not found
+	_, err = store.Duplicate(copyID + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestReadOnly проверяет, что хранилище только для чтения ничего не меняет
+func TestReadOnly(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	id, err := NewParcelStore(db).Add(getTestParcel())
+	require.NoError(t, err)
+
+	store := NewParcelStore(db, ReadOnly(), WithHistory())
+
+	// write
+	_, err = store.Add(getTestParcel())
+	require.ErrorIs(t, err, ErrReadOnly)
+	require.ErrorIs(t, store.SetStatus(id, ParcelStatusSent), ErrReadOnly)
+	require.ErrorIs(t, store.SetAddress(id, "new test address"), ErrReadOnly)
+	require.ErrorIs(t, store.Delete(id), ErrReadOnly)
+	_, err = store.Duplicate(id)
+	require.ErrorIs(t, err, ErrReadOnly)
+	_, _, err = store.UpsertMany([]Parcel{getTestParcel()})
+	require.ErrorIs(t, err, ErrReadOnly)
+
+	// read
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+	require.Equal(t, "test", stored.Address)
+
+	_, _, err = store.GetWithHistory(id)
+	require.NoError(t, err)
+}
+
+// TestGetNextToShip проверяет порядок отправки с учётом приоритета
+func TestGetNextToShip(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for _, createdAt := range []string{
+		"2024-06-01T10:00:00Z",
+		"2024-06-02T10:00:00Z",
+		"2024-06-03T10:00:00Z",
+	} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
 	}
+
+	express := getTestParcel()
+	express.Priority = 5
+	expressID, err := store.Add(express)
+	require.NoError(t, err)
+
+	// самая старая посылка уже отправлена, а одна стала срочной
+	err = store.SetStatus(numbers[0], ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.SetPriority(numbers[2], 1)
+	require.NoError(t, err)
+
+	// check
+	next, err := store.GetNextToShip(10)
+	require.NoError(t, err)
+	require.Len(t, next, 3)
+	require.Equal(t, expressID, next[0].Number)
+	require.Equal(t, 5, next[0].Priority)
+	require.Equal(t, numbers[2], next[1].Number)
+	require.Equal(t, numbers[1], next[2].Number)
+
+	// неположительный limit — ошибка, а не выборка без ограничения
+	_, err = store.GetNextToShip(0)
+	require.Error(t, err)
+	_, err = store.GetNextToShip(-1)
+	require.Error(t, err)
+
+	err = store.SetPriority(expressID+1, 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestGetByCreatedPrefix проверяет выборку посылок по префиксу даты создания
+func TestGetByCreatedPrefix(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for _, createdAt := range []string{
+		"2024-05-31T23:59:59Z",
+		"2024-06-01T10:00:00Z",
+		"2024-06-15T10:00:00Z",
+		"2025-06-01T10:00:00Z",
+	} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	for prefix, count := range map[string]int{"2024": 3, "2024-06": 2, "2024-06-01": 1, "2023": 0} {
+		parcels, err := store.GetByCreatedPrefix(prefix)
+		require.NoError(t, err)
+		require.Len(t, parcels, count, prefix)
+	}
+
+	for _, prefix := range []string{"", "%", "2024-", "2024-6", "2024_06"} {
+		_, err := store.GetByCreatedPrefix(prefix)
+		require.ErrorIs(t, err, ErrInvalidPrefix, prefix)
+	}
+}
+
+// TestFindByAddressRegex проверяет поиск по регулярному выражению для адреса
+func TestFindByAddressRegex(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for _, address := range []string{"ул. Ленина, д. 1", "пр. Мира, д. 12", "ул. Мира, д. 7"} {
+		parcel := getTestParcel()
+		parcel.Address = address
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// find
+	found, err := store.FindByAddressRegex(`Мира, д\. \d$`)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, numbers[2], found[0].Number)
+
+	found, err = store.FindByAddressRegex(`^нет такого`)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	require.Empty(t, found)
+
+	// invalid pattern
+	_, err = store.FindByAddressRegex(`(`)
+	require.ErrorIs(t, err, ErrInvalidPattern)
+}
+
+// TestSearch проверяет общий поиск по адресу, статусу и номеру
+func TestSearch(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for _, address := range []string{"ул. Ленина, д. 1", "скидка 100%", "ул. Мира, д. 12"} {
+		parcel := getTestParcel()
+		parcel.Address = address
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	require.NoError(t, store.SetStatus(numbers[2], ParcelStatusSent))
+
+	numbersOf := func(parcels []Parcel) []int {
+		res := []int{}
+		for _, p := range parcels {
+			res = append(res, p.Number)
+		}
+		return res
+	}
+
+	// address
+	found, err := store.Search("ул.")
+	require.NoError(t, err)
+	require.Equal(t, []int{numbers[0], numbers[2]}, numbersOf(found))
+
+	// wildcards are literal
+	found, err = store.Search("%")
+	require.NoError(t, err)
+	require.Equal(t, []int{numbers[1]}, numbersOf(found))
+	found, err = store.Search("_")
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// status
+	found, err = store.Search(ParcelStatusSent)
+	require.NoError(t, err)
+	require.Equal(t, []int{numbers[2]}, numbersOf(found))
+
+	// number, or address containing it
+	found, err = store.Search(strconv.Itoa(numbers[0]))
+	require.NoError(t, err)
+	require.Contains(t, numbersOf(found), numbers[0])
+	found, err = store.Search("100")
+	require.NoError(t, err)
+	require.Equal(t, []int{numbers[1]}, numbersOf(found))
+
+	// empty term
+	found, err = store.Search("  ")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	require.Empty(t, found)
+}
+
+// TestNoDatabase проверяет, что хранилище без БД возвращает ошибку, а не паникует
+func TestNoDatabase(t *testing.T) {
+	for _, store := range []ParcelStore{NewParcelStore(nil), {}} {
+		_, err := store.Add(getTestParcel())
+		require.ErrorIs(t, err, ErrNoDatabase)
+
+		_, err = store.Get(1)
+		require.ErrorIs(t, err, ErrNoDatabase)
+
+		_, err = store.GetByClient(1000)
+		require.ErrorIs(t, err, ErrNoDatabase)
+
+		require.ErrorIs(t, store.SetStatus(1, ParcelStatusSent), ErrNoDatabase)
+
+		_, err = store.GetHistory(1)
+		require.ErrorIs(t, err, ErrNoDatabase)
+
+		_, errc := store.StreamByClient(context.Background(), 1000)
+		require.ErrorIs(t, <-errc, ErrNoDatabase)
+	}
+}
+
+// TestEmptySlices проверяет, что при отсутствии строк возвращаются пустые срезы, а не nil
+func TestEmptySlices(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	// check
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.NotNil(t, parcels)
+	require.Empty(t, parcels)
+
+	stale, err := store.GetStale(time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, stale)
+
+	history, err := store.GetHistory(1)
+	require.NoError(t, err)
+	require.NotNil(t, history)
+
+	tags, err := store.GetTags(1)
+	require.NoError(t, err)
+	require.NotNil(t, tags)
+}
+
+// TestSwapAddresses проверяет обмен адресами между посылками
+func TestSwapAddresses(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	first := getTestParcel()
+	first.Address = "first"
+	a, err := store.Add(first)
+	require.NoError(t, err)
+
+	second := getTestParcel()
+	second.Address = "second"
+	b, err := store.Add(second)
+	require.NoError(t, err)
+
+	// swap
+	err = store.SwapAddresses(a, b)
+	require.NoError(t, err)
+
+	stored, err := store.Get(a)
+	require.NoError(t, err)
+	require.Equal(t, "second", stored.Address)
+	stored, err = store.Get(b)
+	require.NoError(t, err)
+	require.Equal(t, "first", stored.Address)
+
+	// отправленная посылка не даёт изменить ни одну из двух
+	err = store.SetStatus(b, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.SwapAddresses(a, b)
+	require.ErrorIs(t, err, ErrParcelNotMutable)
+
+	err = store.SwapAddresses(a, b+1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	stored, err = store.Get(a)
+	require.NoError(t, err)
+	require.Equal(t, "second", stored.Address)
+}
+
+// TestGenerateParcels проверяет, что сгенерированные посылки повторяются от запуска к запуску
+func TestGenerateParcels(t *testing.T) {
+	parcels := GenerateParcels(100)
+	require.Len(t, parcels, 100)
+	require.Equal(t, parcels, GenerateParcels(100))
+
+	clients := map[int]bool{}
+	addresses := map[string]bool{}
+	for _, p := range parcels {
+		clients[p.Client] = true
+		addresses[p.Address] = true
+	}
+	require.Greater(t, len(clients), 1)
+	require.Greater(t, len(addresses), 1)
+}
+
+// BenchmarkAdd измеряет добавление посылок по одной
+func BenchmarkAdd(b *testing.B) {
+	db := openTestDB(b)
+	store := NewParcelStore(db)
+	parcels := GenerateParcels(b.N)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := store.Add(parcels[i])
+		require.NoError(b, err)
+	}
+}
+
+// BenchmarkGetByClient измеряет чтение посылок клиента из заполненной таблицы
+func BenchmarkGetByClient(b *testing.B) {
+	db := openTestDB(b)
+	store := NewParcelStore(db)
+	parcels := GenerateParcels(10_000)
+	_, err := store.BatchAdd(parcels)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := store.GetByClient(parcels[i%len(parcels)].Client)
+		require.NoError(b, err)
+	}
+}
+
+// TestReactivate проверяет возврат потерянной посылки в зарегистрированные
+func TestReactivate(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	lost, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(lost, ParcelStatusSent))
+	require.NoError(t, store.MarkLost(lost))
+
+	delivered, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusDelivered))
+
+	// reactivate
+	err = store.Reactivate(lost)
+	require.NoError(t, err)
+
+	// доставленную посылку вернуть нельзя
+	err = store.Reactivate(delivered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// check
+	stored, history, err := store.GetWithHistory(lost)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+	require.Len(t, history, 3)
+	require.Equal(t, ParcelStatusLost, history[2].From)
+	require.Equal(t, ParcelStatusRegistered, history[2].To)
+}
+
+// TestMarkLost проверяет перевод отправленной посылки в потерянные
+func TestMarkLost(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db, WithHistory())
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// зарегистрированную посылку потерять нельзя
+	err = store.MarkLost(id)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// mark lost
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.MarkLost(id)
+	require.NoError(t, err)
+
+	// потерянную посылку нельзя сразу доставить
+	err = store.SetStatus(id, ParcelStatusDelivered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// check
+	stored, history, err := store.GetWithHistory(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusLost, stored.Status)
+	require.Len(t, history, 2)
+	require.Equal(t, ParcelStatusLost, history[1].To)
+
+	next, err := store.GetNextToShip(10)
+	require.NoError(t, err)
+	require.Empty(t, next)
+}
+
+// TestAnonymizeClient проверяет удаление персональных данных клиента
+func TestAnonymizeClient(t *testing.T) {
+	// prepare
+	db := openTestDB(t, WithUniqueParcels())
+	store := NewParcelStore(db)
+
+	// посылки с одинаковым created_at различаются только адресом
+	parcel := getTestParcel()
+	parcel.Notes = "позвонить Ивану"
+	parcel.Weight = 2
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	second := parcel
+	second.Address = "другой адрес"
+	_, err = store.Add(second)
+	require.NoError(t, err)
+
+	other := getTestParcel()
+	other.Client = 2000
+	otherID, err := store.Add(other)
+	require.NoError(t, err)
+
+	before, err := store.Get(id)
+	require.NoError(t, err)
+
+	// anonymize
+	n, err := store.AnonymizeClient(1000)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// check
+	after, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, AnonymizedAddressPrefix+strconv.Itoa(id), after.Address)
+	require.Empty(t, after.Notes)
+	require.Equal(t, before.Status, after.Status)
+	require.Equal(t, before.CreatedAt, after.CreatedAt)
+	require.Equal(t, before.Weight, after.Weight)
+
+	untouched, err := store.Get(otherID)
+	require.NoError(t, err)
+	require.Equal(t, other.Address, untouched.Address)
+
+	// повторный вызов ничего не меняет
+	n, err = store.AnonymizeClient(1000)
+	require.NoError(t, err)
+	require.Zero(t, n)
 }
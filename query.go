@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Columns задаёт физические имена столбцов таблицы parcel.
+// Нужна для работы с унаследованными таблицами, где столбцы названы иначе.
+// Столбцы, которые добавляет Migrate, всегда называются так же, как в InitSchema
+type Columns struct {
+	Number    string
+	Client    string
+	Status    string
+	Address   string
+	CreatedAt string
+}
+
+// DefaultColumns имена столбцов, которые использует InitSchema
+var DefaultColumns = Columns{
+	Number:    "number",
+	Client:    "client",
+	Status:    "status",
+	Address:   "address",
+	CreatedAt: "created_at",
+}
+
+// identifierRe допустимое имя столбца, подставляемое в текст запроса
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// defaultReplacer используется хранилищем, созданным без NewParcelStore
+var defaultReplacer = DefaultColumns.replacer()
+
+// WithColumns задаёт физические имена столбцов таблицы parcel.
+// Если какое-то имя недопустимо, все методы хранилища возвращают ошибку проверки
+func WithColumns(c Columns) StoreOption {
+	return func(s *ParcelStore) {
+		if err := c.Validate(); err != nil {
+			s.err = err
+			return
+		}
+		s.cols = c.replacer()
+	}
+}
+
+// Validate проверяет, что все имена столбцов заданы и являются идентификаторами
+func (c Columns) Validate() error {
+	fields := []struct {
+		field, name string
+	}{
+		{"Number", c.Number},
+		{"Client", c.Client},
+		{"Status", c.Status},
+		{"Address", c.Address},
+		{"CreatedAt", c.CreatedAt},
+	}
+	for _, f := range fields {
+		if !identifierRe.MatchString(f.name) {
+			return fmt.Errorf("invalid column name for %s: %q", f.field, f.name)
+		}
+	}
+
+	return nil
+}
+
+// replacer подставляет имена столбцов вместо {number}, {client} и т.д. в тексте запроса
+func (c Columns) replacer() *strings.Replacer {
+	return strings.NewReplacer(
+		"{number}", c.Number,
+		"{client}", c.Client,
+		"{status}", c.Status,
+		"{address}", c.Address,
+		"{created_at}", c.CreatedAt,
+	)
+}
+
+// sqlText возвращает запрос с подставленными именами столбцов
+func (s ParcelStore) sqlText(query string) string {
+	r := s.cols
+	if r == nil {
+		r = defaultReplacer
+	}
+
+	return s.rebind(r.Replace(query))
+}
+
+// rowScanner общая часть *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// errRow строка, чтение которой сразу возвращает ошибку
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
+
+// ready возвращает ошибку, из-за которой хранилище не может выполнять запросы
+func (s ParcelStore) ready() error {
+	if s.db == nil {
+		return ErrNoDatabase
+	}
+	if s.err != nil {
+		return s.err
+	}
+	// хранилище только для чтения схему не создаёт
+	if s.autoMigrate != nil && !s.readOnly {
+		return s.autoMigrate.run(s.db)
+	}
+
+	return nil
+}
+
+// WithReadTimeout ограничивает время каждого чтения, для которого вызывающий
+// не передал свой контекст. Ноль — без ограничения
+func WithReadTimeout(d time.Duration) StoreOption {
+	return func(s *ParcelStore) {
+		s.readTimeout = d
+	}
+}
+
+// WithWriteTimeout ограничивает время каждой записи и транзакции, для которых
+// вызывающий не передал свой контекст. Ноль — без ограничения
+func WithWriteTimeout(d time.Duration) StoreOption {
+	return func(s *ParcelStore) {
+		s.writeTimeout = d
+	}
+}
+
+// timeoutContext возвращает контекст с таймаутом d, если он задан
+func timeoutContext(d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.Background(), func() {}
+	}
+
+	return context.WithTimeout(context.Background(), d)
+}
+
+// reader возвращает подключение для чтения: отдельное, если задано WithReadDB, иначе основное
+func (s ParcelStore) reader() *sql.DB {
+	if s.readDB != nil {
+		return s.readDB
+	}
+
+	return s.db
+}
+
+func (s ParcelStore) exec(query string, args ...any) (sql.Result, error) {
+	if err := s.ready(); err != nil {
+		return nil, err
+	}
+	if s.readOnly {
+		return nil, ErrReadOnly
+	}
+	if s.retry != nil {
+		return s.execAtomic(query, args...)
+	}
+
+	ctx, cancel := timeoutContext(s.writeTimeout)
+	defer cancel()
+	defer s.lockWrite()()
+
+	return s.db.ExecContext(ctx, s.sqlText(query), args...)
+}
+
+// storeRows результат запроса хранилища. Close освобождает и контекст с таймаутом,
+// и блокировку WithSerializedAccess
+type storeRows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+	unlock func()
+}
+
+func (r *storeRows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	r.unlock()
+
+	return err
+}
+
+func (s ParcelStore) query(query string, args ...any) (*storeRows, error) {
+	ctx, cancel := timeoutContext(s.readTimeout)
+
+	rows, err := s.queryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	rows.cancel = cancel
+
+	return rows, nil
+}
+
+func (s ParcelStore) queryContext(ctx context.Context, query string, args ...any) (*storeRows, error) {
+	if err := s.ready(); err != nil {
+		return nil, err
+	}
+
+	unlock := s.lockRead()
+	var rows *sql.Rows
+	run := func() error {
+		var err error
+		rows, err = s.reader().QueryContext(ctx, s.sqlText(query), args...)
+		return err
+	}
+	// повторить можно только запрос целиком, до чтения первой строки
+	var err error
+	if s.retryReads() {
+		err = s.withRetry(ctx, run)
+	} else {
+		err = run()
+	}
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return &storeRows{Rows: rows, cancel: func() {}, unlock: unlock}, nil
+}
+
+// timedRow строка, которая после чтения освобождает контекст с таймаутом
+// и блокировку WithSerializedAccess
+type timedRow struct {
+	*sql.Row
+	cancel context.CancelFunc
+	unlock func()
+}
+
+func (r timedRow) Scan(dest ...any) error {
+	defer r.cancel()
+	defer r.unlock()
+
+	return r.Row.Scan(dest...)
+}
+
+func (s ParcelStore) queryRow(query string, args ...any) rowScanner {
+	if err := s.ready(); err != nil {
+		return errRow{err}
+	}
+	if s.retryReads() {
+		return retryRow{s: s, run: func(ctx context.Context) *sql.Row {
+			return s.reader().QueryRowContext(ctx, s.sqlText(query), args...)
+		}}
+	}
+
+	ctx, cancel := timeoutContext(s.readTimeout)
+	unlock := s.lockRead()
+
+	return timedRow{Row: s.reader().QueryRowContext(ctx, s.sqlText(query), args...), cancel: cancel, unlock: unlock}
+}
+
+// QueryInto выполняет запрос к db и собирает строки, прочитанные scan, в срез.
+// Срез не бывает nil: если строк нет, возвращается пустой срез.
+// Запрос передаётся в db как есть, имена столбцов хранилища в нём не подставляются
+func QueryInto[T any](db *sql.DB, query string, scan func(*sql.Rows) (T, error), args ...any) ([]T, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectRows(rows, scan)
+}
+
+// queryAll то же, что QueryInto, но запрос выполняется через хранилище:
+// с подстановкой имён столбцов, подключением для чтения и таймаутом
+func queryAll[T any](s ParcelStore, scan func(*sql.Rows) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectRows(rows.Rows, scan)
+}
+
+// collectRows читает все строки rows через scan
+func collectRows[T any](rows *sql.Rows, scan func(*sql.Rows) (T, error)) ([]T, error) {
+	res := []T{}
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// scanString читает строку из одного текстового столбца
+func scanString(rows *sql.Rows) (string, error) {
+	var v string
+	err := rows.Scan(&v)
+	return v, err
+}
+
+// scanInt читает число из одного целочисленного столбца
+func scanInt(rows *sql.Rows) (int, error) {
+	var v int
+	err := rows.Scan(&v)
+	return v, err
+}
+
+// storeTx транзакция, которая подставляет имена столбцов хранилища в запросы.
+// До Commit или Rollback она держит блокировку WithSerializedAccess
+type storeTx struct {
+	*sql.Tx
+	s      ParcelStore
+	cancel context.CancelFunc
+	unlock func()
+}
+
+// begin начинает транзакцию на запись
+func (s ParcelStore) begin() (storeTx, error) {
+	ctx, cancel := timeoutContext(s.writeTimeout)
+
+	return s.beginTimed(ctx, cancel, nil)
+}
+
+// beginRead начинает транзакцию только для чтения, доступную и хранилищу в режиме ReadOnly
+func (s ParcelStore) beginRead() (storeTx, error) {
+	ctx, cancel := timeoutContext(s.readTimeout)
+
+	return s.beginTimed(ctx, cancel, &sql.TxOptions{ReadOnly: true})
+}
+
+// beginTimed начинает транзакцию, которая по завершении освобождает контекст с таймаутом
+func (s ParcelStore) beginTimed(ctx context.Context, cancel context.CancelFunc, opts *sql.TxOptions) (storeTx, error) {
+	tx, err := s.beginTx(ctx, opts)
+	if err != nil {
+		cancel()
+		return storeTx{}, err
+	}
+	tx.cancel = cancel
+
+	return tx, nil
+}
+
+func (s ParcelStore) beginTx(ctx context.Context, opts *sql.TxOptions) (storeTx, error) {
+	if err := s.ready(); err != nil {
+		return storeTx{}, err
+	}
+	if s.readOnly && (opts == nil || !opts.ReadOnly) {
+		return storeTx{}, ErrReadOnly
+	}
+
+	db := s.db
+	if opts != nil && opts.ReadOnly {
+		db = s.reader()
+	}
+
+	unlock := s.lockWrite
+	if opts != nil && opts.ReadOnly {
+		unlock = s.lockRead
+	}
+	release := unlock()
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		release()
+		return storeTx{}, err
+	}
+
+	return storeTx{Tx: tx, s: s, cancel: func() {}, unlock: release}, nil
+}
+
+// RunInTx выполняет fn в одной транзакции: фиксирует её, если fn вернула nil,
+// и откатывает в противном случае. opts передаются в BeginTx, nil — обычная транзакция на запись.
+// Запросы внутри fn пишутся с физическими именами столбцов.
+//
+// SQLite-драйвер уровни изоляции не различает: транзакция SQLite всегда
+// сериализуемая, поэтому любой Isolation даёт sql.LevelSerializable.
+// ReadOnly драйвер тоже не проверяет, её учитывает хранилище: такая транзакция
+// идёт в подключение для чтения и доступна в режиме ReadOnly, но запись из fn она не запрещает
+func (s ParcelStore) RunInTx(opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	timeout := s.writeTimeout
+	if opts != nil && opts.ReadOnly {
+		timeout = s.readTimeout
+	}
+	ctx, cancel := timeoutContext(timeout)
+
+	tx, err := s.beginTimed(ctx, cancel, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx.Tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (tx storeTx) Commit() error {
+	defer tx.cancel()
+	defer tx.unlock()
+
+	return tx.Tx.Commit()
+}
+
+func (tx storeTx) Rollback() error {
+	defer tx.cancel()
+	defer tx.unlock()
+
+	return tx.Tx.Rollback()
+}
+
+func (tx storeTx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(tx.s.sqlText(query), args...)
+}
+
+func (tx storeTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.s.sqlText(query), args...)
+}
+
+func (tx storeTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.s.sqlText(query), args...)
+}
+
+func (tx storeTx) QueryRow(query string, args ...any) rowScanner {
+	return tx.Tx.QueryRow(tx.s.sqlText(query), args...)
+}
+
+func (tx storeTx) QueryRowContext(ctx context.Context, query string, args ...any) rowScanner {
+	return tx.Tx.QueryRowContext(ctx, tx.s.sqlText(query), args...)
+}
+
+func (tx storeTx) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.Prepare(tx.s.sqlText(query))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// legacyColumns имена столбцов унаследованной таблицы
+var legacyColumns = Columns{
+	Number:    "id",
+	Client:    "customer",
+	Status:    "state",
+	Address:   "addr",
+	CreatedAt: "ts",
+}
+
+// TestLegacyColumns проверяет работу хранилища с таблицей, где столбцы названы иначе
+func TestLegacyColumns(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE parcel (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		customer INTEGER NOT NULL,
+		state    TEXT    NOT NULL,
+		addr     TEXT    NOT NULL,
+		ts       TEXT    NOT NULL
+	)`)
+	require.NoError(t, err)
+	require.NoError(t, Migrate(db))
+
+	store := NewParcelStore(db, WithColumns(legacyColumns))
+	parcel := getTestParcel()
+
+	// add
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// set address
+	err = store.SetAddress(id, "new test address")
+	require.NoError(t, err)
+
+	// set status
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// check
+	parcels, err := store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, id, parcels[0].Number)
+	require.Equal(t, "new test address", parcels[0].Address)
+	require.Equal(t, ParcelStatusSent, parcels[0].Status)
+	require.Equal(t, parcel.CreatedAt, parcels[0].CreatedAt)
+}
+
+// TestInvalidColumns проверяет, что недопустимое имя столбца не попадает в запрос
+func TestInvalidColumns(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	cols := DefaultColumns
+	cols.Address = "address; DROP TABLE parcel"
+
+	require.Error(t, cols.Validate())
+	store := NewParcelStore(db, WithColumns(cols))
+
+	// check
+	_, err := store.Add(getTestParcel())
+	require.Error(t, err)
+
+	_, err = store.Get(1)
+	require.Error(t, err)
+
+	_, err = NewParcelStore(db).GetByClient(1000)
+	require.NoError(t, err)
+}
+
+// TestReadDB проверяет, что чтение идёт в отдельное подключение, а запись — в основное
+func TestReadDB(t *testing.T) {
+	// prepare
+	primary := openTestDB(t)
+	replica := openTestDB(t)
+	store := NewParcelStore(primary, WithReadDB(replica))
+
+	// на «реплике» лежит своя посылка, чтобы было видно, откуда пришло чтение
+	replicaParcel := getTestParcel()
+	replicaParcel.Address = "replica"
+	_, err := NewParcelStore(replica).Add(replicaParcel)
+	require.NoError(t, err)
+
+	// write
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	err = store.SetAddress(id, "primary")
+	require.NoError(t, err)
+
+	// read
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "replica", stored.Address)
+
+	stored, err = NewParcelStore(primary).Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "primary", stored.Address)
+}
+
+// TestStoreTimeouts проверяет, что таймауты хранилища действуют на запросы без своего контекста
+func TestStoreTimeouts(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	id, err := NewParcelStore(db).Add(getTestParcel())
+	require.NoError(t, err)
+
+	// заданные с запасом таймауты не мешают обычной работе
+	store := NewParcelStore(db, WithReadTimeout(time.Minute), WithWriteTimeout(time.Minute))
+	_, err = store.Get(id)
+	require.NoError(t, err)
+	require.NoError(t, store.SetAddress(id, "new address"))
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	_, err = store.GetByClient(getTestParcel().Client)
+	require.NoError(t, err)
+
+	// истёкший таймаут прерывает чтение и запись
+	_, err = NewParcelStore(db, WithReadTimeout(time.Nanosecond)).Get(id)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = NewParcelStore(db, WithWriteTimeout(time.Nanosecond)).Add(getTestParcel())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestRunInTx проверяет фиксацию и откат транзакции RunInTx
+func TestRunInTx(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// commit
+	err = store.RunInTx(&sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE parcel SET address = ? WHERE number = ?", "committed", id)
+		return err
+	})
+	require.NoError(t, err)
+
+	// rollback
+	errFailed := errors.New("failed")
+	err = store.RunInTx(nil, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE parcel SET address = ? WHERE number = ?", "rolled back", id); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+
+	// read only
+	var address string
+	err = NewParcelStore(db, ReadOnly()).RunInTx(&sql.TxOptions{ReadOnly: true}, func(tx *sql.Tx) error {
+		return tx.QueryRow("SELECT address FROM parcel WHERE number = ?", id).Scan(&address)
+	})
+	require.NoError(t, err)
+	require.Equal(t, "committed", address)
+
+	err = NewParcelStore(db, ReadOnly()).RunInTx(nil, func(tx *sql.Tx) error { return nil })
+	require.ErrorIs(t, err, ErrReadOnly)
+}
+
+// TestQueryInto проверяет чтение произвольной проекции через QueryInto
+func TestQueryInto(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for _, address := range []string{"a", "b"} {
+		parcel := getTestParcel()
+		parcel.Address = address
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	type projection struct {
+		Number  int
+		Address string
+	}
+	scan := func(rows *sql.Rows) (projection, error) {
+		var p projection
+		err := rows.Scan(&p.Number, &p.Address)
+		return p, err
+	}
+
+	// query
+	res, err := QueryInto(db, "SELECT number, address FROM parcel WHERE client = ? ORDER BY number", scan, 1000)
+	require.NoError(t, err)
+	require.Equal(t, []projection{{1, "a"}, {2, "b"}}, res)
+
+	res, err = QueryInto(db, "SELECT number, address FROM parcel WHERE client = ?", scan, -1)
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	require.Empty(t, res)
+}
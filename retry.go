@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// RetryPolicy задаёт повторы операций, которые не смогли получить блокировку БД
+type RetryPolicy struct {
+	// Attempts сколько всего попыток делается, значения меньше 1 означают одну попытку
+	Attempts int
+	// Backoff пауза перед второй попыткой, перед каждой следующей она удваивается
+	Backoff time.Duration
+	// Reads включает повторы и для чтений хранилища. Отдельная транзакция чтения
+	// для них не открывается: один запрос SQLite и так читает согласованный снимок.
+	// Запрос, вернувший несколько строк, повторяется, только если БД была занята до первой строки
+	Reads bool
+}
+
+// WithAtomicRetry включает режим, в котором каждый изменяющий метод хранилища
+// выполняется в своей транзакции и при SQLITE_BUSY или SQLITE_LOCKED повторяется
+// целиком по правилам p, так что вызывающему не нужен RunInTx.
+// Режим увеличивает число запросов и время ожидания, поэтому по умолчанию выключен.
+// Транзакция RunInTx не повторяется: её fn может иметь побочные эффекты вне БД
+func WithAtomicRetry(p RetryPolicy) StoreOption {
+	return func(s *ParcelStore) {
+		s.retry = &p
+	}
+}
+
+// isBusy проверяет, что операция не выполнена из-за блокировки БД другим подключением
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// withRetry выполняет fn и при занятой БД повторяет её по правилам WithAtomicRetry.
+// Без этого режима fn выполняется один раз. Пауза между попытками прерывается
+// отменой ctx, тогда возвращается ctx.Err()
+func (s ParcelStore) withRetry(ctx context.Context, fn func() error) error {
+	if s.retry == nil {
+		return fn()
+	}
+
+	backoff := s.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= s.retry.Attempts || !isBusy(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryReads сообщает, включены ли повторы чтений
+func (s ParcelStore) retryReads() bool {
+	return s.retry != nil && s.retry.Reads
+}
+
+// update выполняет fn в транзакции на запись и фиксирует её, если fn вернула nil.
+// В режиме WithAtomicRetry при занятой БД транзакция повторяется целиком,
+// поэтому fn не должна менять ничего, кроме БД
+func (s ParcelStore) update(fn func(tx storeTx) error) error {
+	return s.runUpdate(context.Background(), s.begin, fn)
+}
+
+// updateContext то же, что update, но транзакция ограничена контекстом вызывающего
+func (s ParcelStore) updateContext(ctx context.Context, fn func(tx storeTx) error) error {
+	return s.runUpdate(ctx, func() (storeTx, error) { return s.beginTx(ctx, nil) }, fn)
+}
+
+func (s ParcelStore) runUpdate(ctx context.Context, begin func() (storeTx, error), fn func(tx storeTx) error) error {
+	return s.withRetry(ctx, func() error {
+		tx, err := begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// execAtomic выполняет запрос exec в режиме WithAtomicRetry: в своей транзакции с повторами
+func (s ParcelStore) execAtomic(query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := s.update(func(tx storeTx) error {
+		var err error
+		res, err = tx.Exec(query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// retryRow строка, чтение которой повторяется вместе с запросом, если БД занята
+type retryRow struct {
+	s   ParcelStore
+	run func(ctx context.Context) *sql.Row
+}
+
+func (r retryRow) Scan(dest ...any) error {
+	return r.s.withRetry(context.Background(), func() error {
+		ctx, cancel := timeoutContext(r.s.readTimeout)
+		defer cancel()
+		defer r.s.lockRead()()
+
+		return r.run(ctx).Scan(dest...)
+	})
+}
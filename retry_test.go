@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAtomicRetry проверяет повтор записи, пока БД заблокирована другим подключением
+func TestAtomicRetry(t *testing.T) {
+	// prepare: без ожидания блокировки занятая БД сразу даёт SQLITE_BUSY
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	db, err := OpenSQLite(path, WithBusyTimeout(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, InitSchema(db))
+
+	other, err := OpenSQLite(path, WithBusyTimeout(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { other.Close() })
+
+	ctx := context.Background()
+	lock, err := other.Conn(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() { lock.Close() })
+	_, err = lock.ExecContext(ctx, "BEGIN IMMEDIATE")
+	require.NoError(t, err)
+
+	// без режима ошибка возвращается сразу
+	_, err = NewParcelStore(db).Add(getTestParcel())
+	require.True(t, isBusy(err), err)
+
+	// retry: блокировка снимается, пока хранилище повторяет запись
+	store := NewParcelStore(db, WithAtomicRetry(RetryPolicy{Attempts: 10, Backoff: 10 * time.Millisecond}))
+	released := make(chan error, 1)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_, err := lock.ExecContext(ctx, "COMMIT")
+		released <- err
+	}()
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, <-released)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+
+	// ошибки, не связанные с блокировкой, не повторяются
+	err = store.SetStatus(id, ParcelStatusRegistered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+}
+
+// TestAtomicRetryContext проверяет, что отмена контекста прерывает паузу между повторами
+func TestAtomicRetryContext(t *testing.T) {
+	// prepare
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	db, err := OpenSQLite(path, WithBusyTimeout(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, InitSchema(db))
+
+	other, err := OpenSQLite(path, WithBusyTimeout(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { other.Close() })
+
+	lock, err := other.Conn(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { lock.Close() })
+	_, err = lock.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+	require.NoError(t, err)
+
+	// retry: пауза больше таймаута контекста
+	store := NewParcelStore(db, WithAtomicRetry(RetryPolicy{Attempts: 10, Backoff: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = store.BatchAddContext(ctx, []Parcel{getTestParcel()})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Minute)
+}
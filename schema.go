@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSchemaMismatch возвращается VerifySchema, если таблица parcel не совпадает с ожидаемой
+var ErrSchemaMismatch = errors.New("parcel schema mismatch")
+
+// columnSpec столбец таблицы parcel, без которого хранилище не работает
+type columnSpec struct {
+	name     string
+	affinity string
+}
+
+// requiredColumns столбцы, к которым обращаются запросы хранилища
+var requiredColumns = []columnSpec{
+	{"number", "INTEGER"},
+	{"client", "INTEGER"},
+	{"status", "TEXT"},
+	{"address", "TEXT"},
+	{"created_at", "TEXT"},
+	{"updated_at", "TEXT"},
+	{"priority", "INTEGER"},
+	{"carrier", "TEXT"},
+	{"notes", "TEXT"},
+	{"claimed_by", "TEXT"},
+	{"weight", "REAL"},
+	{"delivered_at", "TEXT"},
+	{"length", "REAL"},
+	{"width", "REAL"},
+	{"height", "REAL"},
+}
+
+// SchemaOption настраивает создание схемы в InitSchema
+type SchemaOption func(*schemaConfig)
+
+type schemaConfig struct {
+	uniqueParcels bool
+	clientStats   bool
+}
+
+// WithUniqueParcels создаёт уникальный индекс по (client, address, created_at),
+// после чего Add возвращает ErrDuplicateParcel для точных дубликатов.
+// Индекс не создастся, если в таблице уже есть такие дубликаты
+func WithUniqueParcels() SchemaOption {
+	return func(c *schemaConfig) {
+		c.uniqueParcels = true
+	}
+}
+
+// WithClientStats создаёт таблицу client_stats для кэша количества посылок
+// клиента по статусам (см. RefreshClientStats и GetClientStats)
+func WithClientStats() SchemaOption {
+	return func(c *schemaConfig) {
+		c.clientStats = true
+	}
+}
+
+// InitSchema приводит схему к текущей версии через Migrate
+// и создаёт запрошенные опциями индексы
+func InitSchema(db *sql.DB, opts ...SchemaOption) error {
+	cfg := schemaConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if err := Migrate(db); err != nil {
+		return err
+	}
+
+	if cfg.uniqueParcels {
+		_, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS parcel_client_address_created_at
+			ON parcel (client, address, created_at)`)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.clientStats {
+		_, err := db.Exec(`CREATE TABLE IF NOT EXISTS client_stats (
+			client INTEGER NOT NULL,
+			status TEXT    NOT NULL,
+			count  INTEGER NOT NULL,
+			PRIMARY KEY (client, status)
+		)`)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateIndexes создаёт индексы по client, status и created_at, если их ещё нет.
+// Без индекса по client каждый GetByClient читает всю таблицу, с ним —
+// только строки клиента, что на больших таблицах ускоряет чтение на порядки
+// (см. BenchmarkGetByClientIndexes). Плата — немного более медленные вставки
+// и обновления этих столбцов и место под индексы в файле БД
+func CreateIndexes(db *sql.DB) error {
+	for _, query := range []string{
+		"CREATE INDEX IF NOT EXISTS parcel_client ON parcel (client)",
+		"CREATE INDEX IF NOT EXISTS parcel_status ON parcel (status)",
+		"CREATE INDEX IF NOT EXISTS parcel_created_at ON parcel (created_at)",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifySchema проверяет, что в таблице parcel есть все нужные столбцы
+// подходящих типов. Ошибка перечисляет все найденные расхождения
+func VerifySchema(db *sql.DB) error {
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info('parcel')")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	actual := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return err
+		}
+		actual[strings.ToLower(name)] = typ
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(actual) == 0 {
+		return fmt.Errorf("%w: table parcel does not exist", ErrSchemaMismatch)
+	}
+
+	var problems []string
+	for _, col := range requiredColumns {
+		typ, ok := actual[col.name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("missing column %s", col.name))
+			continue
+		}
+		if affinity(typ) != col.affinity {
+			problems = append(problems, fmt.Sprintf("column %s has type %q, want %s", col.name, typ, col.affinity))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaMismatch, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// affinity определяет тип столбца по правилам SQLite
+// (https://www.sqlite.org/datatype3.html#determination_of_column_affinity)
+func affinity(typ string) string {
+	typ = strings.ToUpper(typ)
+	switch {
+	case strings.Contains(typ, "INT"):
+		return "INTEGER"
+	case strings.Contains(typ, "CHAR"), strings.Contains(typ, "CLOB"), strings.Contains(typ, "TEXT"):
+		return "TEXT"
+	case typ == "", strings.Contains(typ, "BLOB"):
+		return "BLOB"
+	case strings.Contains(typ, "REAL"), strings.Contains(typ, "FLOA"), strings.Contains(typ, "DOUB"):
+		return "REAL"
+	default:
+		return "NUMERIC"
+	}
+}
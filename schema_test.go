@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestUniqueParcels проверяет, что с уникальным индексом точный дубликат не добавляется
+func TestUniqueParcels(t *testing.T) {
+	// prepare
+	db := openTestDB(t, WithUniqueParcels())
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+
+	// add
+	_, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// duplicate
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrDuplicateParcel)
+
+	// другой адрес дубликатом не считается
+	parcel.Address = "another test address"
+	_, err = store.Add(parcel)
+	require.NoError(t, err)
+}
+
+// TestInitSchemaWithDuplicates проверяет, что без индекса дубликаты допустимы,
+// а индекс нельзя создать поверх них
+func TestInitSchemaWithDuplicates(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+
+	// add
+	for i := 0; i < 2; i++ {
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	err := InitSchema(db, WithUniqueParcels())
+	require.Error(t, err)
+}
+
+// TestVerifySchema проверяет обнаружение расхождений в схеме
+func TestVerifySchema(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+
+	// check
+	require.NoError(t, VerifySchema(db))
+
+	// drift
+	_, err := db.Exec("DROP TABLE parcel")
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE parcel (
+		number  INTEGER PRIMARY KEY,
+		client  TEXT,
+		status  TEXT,
+		address TEXT
+	)`)
+	require.NoError(t, err)
+
+	err = VerifySchema(db)
+	require.ErrorIs(t, err, ErrSchemaMismatch)
+	require.Contains(t, err.Error(), "missing column created_at")
+	require.Contains(t, err.Error(), "column client has type")
+
+	// no table
+	_, err = db.Exec("DROP TABLE parcel")
+	require.NoError(t, err)
+	require.ErrorIs(t, VerifySchema(db), ErrSchemaMismatch)
+}
+
+// TestCreateIndexes проверяет создание индексов и повторный вызов
+func TestCreateIndexes(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+
+	// create
+	require.NoError(t, CreateIndexes(db))
+	require.NoError(t, CreateIndexes(db))
+
+	// check
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name IN ('parcel_client', 'parcel_status', 'parcel_created_at')").Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
+
+// BenchmarkGetByClientIndexes сравнивает GetByClient на заполненной таблице без индекса и с ним
+func BenchmarkGetByClientIndexes(b *testing.B) {
+	// prepare
+	db := openTestDB(b)
+	store := NewParcelStore(db)
+
+	_, err := store.BatchAdd(GenerateParcels(20_000))
+	require.NoError(b, err)
+
+	b.Run("no_index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := store.GetByClient(i%2000 + 1)
+			require.NoError(b, err)
+		}
+	})
+
+	require.NoError(b, CreateIndexes(db))
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := store.GetByClient(i%2000 + 1)
+			require.NoError(b, err)
+		}
+	})
+}
+
+// TestAutoMigrate проверяет создание схемы при первом обращении хранилища к БД
+func TestAutoMigrate(t *testing.T) {
+	// prepare: пустая БД без таблиц
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = NewParcelStore(db).Add(getTestParcel())
+	require.Error(t, err)
+
+	// хранилище только для чтения схему не создаёт
+	_, err = NewParcelStore(db, WithAutoMigrate(), ReadOnly()).Get(1)
+	require.Error(t, err)
+	require.Error(t, VerifySchema(db))
+
+	// auto migrate
+	store := NewParcelStore(db, WithAutoMigrate())
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	_, err = store.Get(id)
+	require.NoError(t, err)
+	require.NoError(t, VerifySchema(db))
+}
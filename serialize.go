@@ -0,0 +1,40 @@
+package main
+
+import "sync"
+
+// WithSerializedAccess упорядочивает обращения хранилища к БД внутри процесса:
+// запись и транзакции на запись берут блокировку на запись, чтения — на чтение.
+// Пока идёт запись, ничто другое не выполняется, поэтому внутри одного процесса
+// SQLITE_BUSY не возникает, но и параллельной записи нет: пропускная способность
+// ограничена одной операцией записи за раз. Подходит для однопроцессных приложений.
+//
+// Блокировка общая для всех копий хранилища, но не для других хранилищ на той же БД.
+// Чтение держит блокировку, пока не закрыты строки, а транзакция — до Commit или
+// Rollback, поэтому fn в EachParcel, StreamByClient и RunInTx не должна вызывать
+// методы хранилища: это приведёт к взаимной блокировке
+func WithSerializedAccess() StoreOption {
+	return func(s *ParcelStore) {
+		s.mu = &sync.RWMutex{}
+	}
+}
+
+// lockRead берёт блокировку на чтение, если включён WithSerializedAccess,
+// и возвращает функцию, которая её снимает. Повторный вызов этой функции ничего не делает
+func (s ParcelStore) lockRead() func() {
+	if s.mu == nil {
+		return func() {}
+	}
+
+	s.mu.RLock()
+	return sync.OnceFunc(s.mu.RUnlock)
+}
+
+// lockWrite то же, что lockRead, но для блокировки на запись
+func (s ParcelStore) lockWrite() func() {
+	if s.mu == nil {
+		return func() {}
+	}
+
+	s.mu.Lock()
+	return sync.OnceFunc(s.mu.Unlock)
+}
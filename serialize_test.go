@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSerializedAccess проверяет, что параллельная запись из одного процесса
+// не получает SQLITE_BUSY даже без ожидания блокировки
+func TestSerializedAccess(t *testing.T) {
+	// prepare
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	db, err := OpenSQLite(path, WithBusyTimeout(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, InitSchema(db))
+
+	store := NewParcelStore(db, WithSerializedAccess())
+
+	// add
+	const workers, perWorker = 8, 20
+	errs := make(chan error, workers*perWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				id, err := store.Add(getTestParcel())
+				if err == nil {
+					err = store.SetStatus(id, ParcelStatusSent)
+				}
+				if err == nil {
+					_, err = store.Get(id)
+				}
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// check
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	counts, err := store.GlobalStatusCounts()
+	require.NoError(t, err)
+	require.Equal(t, workers*perWorker, counts[ParcelStatusSent])
+}
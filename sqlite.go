@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SQLiteOption настраивает подключение, открываемое OpenSQLite
+type SQLiteOption func(*sqliteConfig)
+
+type sqliteConfig struct {
+	busyTimeout time.Duration
+	journalMode string
+}
+
+// WithBusyTimeout задаёт, сколько подключение ждёт снятия чужой блокировки,
+// прежде чем вернуть SQLITE_BUSY. По умолчанию 5 секунд
+func WithBusyTimeout(d time.Duration) SQLiteOption {
+	return func(c *sqliteConfig) {
+		c.busyTimeout = d
+	}
+}
+
+// WithJournalMode задаёт режим журнала вместо WAL, например "DELETE"
+func WithJournalMode(mode string) SQLiteOption {
+	return func(c *sqliteConfig) {
+		c.journalMode = mode
+	}
+}
+
+// OpenSQLite открывает БД SQLite по пути path и проверяет подключение.
+// Каждое подключение пула получает режим журнала WAL, включённые внешние ключи
+// и время ожидания блокировки. Для ":memory:" пул ограничен одним подключением:
+// иначе каждое новое подключение видело бы свою пустую БД
+func OpenSQLite(path string, opts ...SQLiteOption) (*sql.DB, error) {
+	cfg := sqliteConfig{busyTimeout: 5 * time.Second, journalMode: "WAL"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	pragmas := url.Values{}
+	pragmas.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", cfg.busyTimeout.Milliseconds()))
+	pragmas.Add("_pragma", "foreign_keys(1)")
+	memory := path == ":memory:"
+	if !memory {
+		// БД в памяти WAL не поддерживает
+		pragmas.Add("_pragma", fmt.Sprintf("journal_mode(%s)", cfg.journalMode))
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	db, err := sql.Open("sqlite", path+sep+pragmas.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if memory {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
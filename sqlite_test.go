@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenSQLite проверяет настройки подключения к файловой БД
+func TestOpenSQLite(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "tracker.db"), WithBusyTimeout(2*time.Second))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	var mode string
+	var foreignKeys, busyTimeout int
+	require.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	require.NoError(t, db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	require.NoError(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	require.Equal(t, "wal", strings.ToLower(mode))
+	require.Equal(t, 1, foreignKeys)
+	require.Equal(t, 2000, busyTimeout)
+}
+
+// TestOpenSQLiteMemory проверяет, что БД в памяти видна всем запросам хранилища
+func TestOpenSQLiteMemory(t *testing.T) {
+	db, err := OpenSQLite(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.Equal(t, 1, db.Stats().MaxOpenConnections)
+
+	require.NoError(t, InitSchema(db))
+	store := NewParcelStore(db)
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Get(id)
+	require.NoError(t, err)
+}
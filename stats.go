@@ -0,0 +1,361 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DailyCounts возвращает количество зарегистрированных посылок по дням
+// в полуинтервале [from, to). Ключ — дата в формате YYYY-MM-DD по UTC,
+// дни без посылок в результат не попадают
+func (s ParcelStore) DailyCounts(from, to time.Time) (map[string]int, error) {
+	rows, err := s.query(`SELECT substr({created_at}, 1, 10) AS day, COUNT(*) FROM parcel
+		WHERE {created_at} >= ? AND {created_at} < ?
+		GROUP BY day`, formatTime(from), formatTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		res[day] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GlobalStatusCounts возвращает количество посылок в каждом статусе по всей таблице.
+// Статусы без посылок в результат не попадают, зато попадают любые
+// встречающиеся в данных, в том числе неизвестные
+func (s ParcelStore) GlobalStatusCounts() (map[string]int, error) {
+	rows, err := s.query("SELECT {status}, COUNT(*) FROM parcel GROUP BY {status}")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		res[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// WeightByStatus возвращает суммарный вес посылок в каждом статусе, например сколько
+// килограммов ещё зарегистрировано и сколько в пути. Статусы без посылок в результат не попадают
+func (s ParcelStore) WeightByStatus() (map[string]float64, error) {
+	rows, err := s.query("SELECT {status}, COALESCE(SUM(weight), 0) FROM parcel GROUP BY {status}")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]float64{}
+	for rows.Next() {
+		var status string
+		var weight float64
+		if err := rows.Scan(&status, &weight); err != nil {
+			return nil, err
+		}
+		res[status] = weight
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CountByAddressPrefix возвращает количество посылок по первым prefixLen символам адреса,
+// например по городу для карты распределения. Это грубая оценка без геокодирования:
+// она точна ровно настолько, насколько единообразно записаны адреса, и «Москва, ...»
+// и «г. Москва, ...» попадут в разные группы
+func (s ParcelStore) CountByAddressPrefix(prefixLen int) (map[string]int, error) {
+	if prefixLen <= 0 {
+		return nil, fmt.Errorf("address prefix length must be positive, got %d", prefixLen)
+	}
+
+	rows, err := s.query("SELECT substr({address}, 1, ?) AS prefix, COUNT(*) FROM parcel GROUP BY prefix", prefixLen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var prefix string
+		var count int
+		if err := rows.Scan(&prefix, &count); err != nil {
+			return nil, err
+		}
+		res[prefix] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CountByClientSince возвращает количество посылок клиента, созданных начиная с момента since.
+// Граница приводится к UTC, как и хранимое время, поэтому сравнение строк
+// совпадает с хронологическим
+func (s ParcelStore) CountByClientSince(client int, since time.Time) (int, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM parcel WHERE {client} = ? AND {created_at} >= ?",
+		client, s.timeArg(since)).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MaxNumber возвращает наибольший номер посылки или 0, если посылок нет.
+// Вместе с CountSince позволяет дешёвым опросом узнавать о новых посылках без меток времени
+func (s ParcelStore) MaxNumber() (int, error) {
+	var number int
+	err := s.queryRow("SELECT COALESCE(MAX({number}), 0) FROM parcel").Scan(&number)
+	if err != nil {
+		return 0, err
+	}
+
+	return number, nil
+}
+
+// CountSince возвращает количество посылок с номером больше lastMaxNumber —
+// значения MaxNumber при прошлой проверке. Номера растут, поэтому это посылки,
+// добавленные с тех пор; удалённые за это время посылки не учитываются
+func (s ParcelStore) CountSince(lastMaxNumber int) (int, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM parcel WHERE {number} > ?", lastMaxNumber).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// DeliveryRate возвращает долю доставленных среди завершённых посылок клиента:
+// delivered / (delivered + lost). Посылки в пути не учитываются.
+// Если завершённых посылок нет, возвращает 0
+func (s ParcelStore) DeliveryRate(client int) (float64, error) {
+	rows, err := s.query("SELECT {status}, COUNT(*) FROM parcel WHERE {client} = ? AND {status} IN (?, ?) GROUP BY {status}",
+		client, ParcelStatusDelivered, ParcelStatusLost)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return 0, err
+		}
+		counts[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	finished := counts[ParcelStatusDelivered] + counts[ParcelStatusLost]
+	if finished == 0 {
+		return 0, nil
+	}
+
+	return float64(counts[ParcelStatusDelivered]) / float64(finished), nil
+}
+
+// Throughput возвращает, сколько посылок создано и сколько доставлено в полуинтервале [from, to).
+// Границы приводятся к UTC, как и хранимое время, поэтому сравнение строк
+// совпадает с хронологическим. Время доставки записывается при переходе в delivered,
+// у посылок, доставленных до появления столбца delivered_at, его нет
+func (s ParcelStore) Throughput(from, to time.Time) (created int, delivered int, err error) {
+	err = s.queryRow(`SELECT
+			(SELECT COUNT(*) FROM parcel WHERE {created_at} >= ? AND {created_at} < ?),
+			(SELECT COUNT(*) FROM parcel WHERE delivered_at >= ? AND delivered_at < ?)`,
+		s.timeArg(from), s.timeArg(to), formatTime(from), formatTime(to)).Scan(&created, &delivered)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return created, delivered, nil
+}
+
+// CountByClientAndStatus возвращает количество посылок каждого клиента в каждом статусе
+// одним запросом: ключ внешней карты — клиент, внутренней — статус.
+// Пары без посылок в результат не попадают
+func (s ParcelStore) CountByClientAndStatus() (map[int]map[string]int, error) {
+	rows, err := s.query("SELECT {client}, {status}, COUNT(*) FROM parcel GROUP BY {client}, {status}")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[int]map[string]int{}
+	for rows.Next() {
+		var client, count int
+		var status string
+		if err := rows.Scan(&client, &status, &count); err != nil {
+			return nil, err
+		}
+		if res[client] == nil {
+			res[client] = map[string]int{}
+		}
+		res[client][status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// RefreshClientStats пересчитывает количество посылок клиента по статусам
+// и сохраняет его в client_stats. Таблица создаётся в InitSchema с WithClientStats.
+// Изменения посылок кэш не обновляют: пока он не пересчитан, GetClientStats
+// возвращает прежние значения. Так чтение панелей не зависит от размера таблицы
+// parcel, а цена переносится на запись и периодический пересчёт
+func (s ParcelStore) RefreshClientStats(client int) error {
+	return s.update(func(tx storeTx) error {
+		return refreshClientStats(tx, client)
+	})
+}
+
+// WithClientStatsCache сообщает хранилищу, что в БД есть таблица client_stats
+// (InitSchema с WithClientStats). Тогда MergeClients поддерживает кэш в согласованном виде
+func WithClientStatsCache() StoreOption {
+	return func(s *ParcelStore) {
+		s.clientStats = true
+	}
+}
+
+// refreshClientStats пересчитывает кэш клиента в транзакции tx
+func refreshClientStats(tx storeTx, client int) error {
+	if _, err := tx.Exec("DELETE FROM client_stats WHERE client = ?", client); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO client_stats (client, status, count)
+		SELECT {client}, {status}, COUNT(*) FROM parcel WHERE {client} = ? GROUP BY {status}`, client)
+	return err
+}
+
+// GetClientStats возвращает сохранённое RefreshClientStats количество посылок
+// клиента по статусам. Для клиента без пересчёта карта пустая
+func (s ParcelStore) GetClientStats(client int) (map[string]int, error) {
+	rows, err := s.query("SELECT status, count FROM client_stats WHERE client = ?", client)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		res[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DistinctStatuses возвращает все встречающиеся в таблице статусы в алфавитном порядке.
+// Значения, не совпадающие с известными константами, указывают на данные
+// из старых систем
+func (s ParcelStore) DistinctStatuses() ([]string, error) {
+	return queryAll(s, scanString, "SELECT DISTINCT {status} FROM parcel ORDER BY {status}")
+}
+
+// AverageAgeByStatus возвращает средний возраст посылок в каждом статусе
+// по часам хранилища. Статусы без посылок в результат не попадают.
+// Посылки, у которых created_at пустое или не разбирается как RFC3339, пропускаются,
+// чтобы одна грязная строка не ломала отчёт. Найти их можно через FindInvalidTimestamps
+func (s ParcelStore) AverageAgeByStatus() (map[string]time.Duration, error) {
+	rows, err := s.query("SELECT {status}, {created_at} FROM parcel")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := s.now()
+	total := map[string]time.Duration{}
+	count := map[string]int{}
+	for rows.Next() {
+		var status string
+		var createdAt sql.NullString
+		if err := rows.Scan(&status, &createdAt); err != nil {
+			return nil, err
+		}
+
+		created, err := time.Parse(time.RFC3339, createdAt.String)
+		if err != nil {
+			continue
+		}
+		total[status] += now.Sub(created)
+		count[status]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]time.Duration, len(total))
+	for status, sum := range total {
+		res[status] = sum / time.Duration(count[status])
+	}
+
+	return res, nil
+}
+
+// rowOverheadBytes условный размер строки parcel без учёта текстовых столбцов:
+// числовые столбцы, заголовок записи и ключ
+const rowOverheadBytes = 32
+
+// EstimateClientBytes оценивает объём данных клиента в байтах: длина address,
+// status и created_at в UTF-8 плюс rowOverheadBytes на каждую посылку.
+// Это оценка для мягких квот, а не реальный размер на диске: страницы,
+// индексы и свободное место в файле БД не учитываются
+func (s ParcelStore) EstimateClientBytes(client int) (int64, error) {
+	var size int64
+	err := s.queryRow(`SELECT COALESCE(SUM(
+			LENGTH(CAST({address} AS BLOB)) + LENGTH(CAST({status} AS BLOB)) +
+			COALESCE(LENGTH(CAST({created_at} AS BLOB)), 0) + ?), 0)
+		FROM parcel WHERE {client} = ?`, rowOverheadBytes, client).Scan(&size)
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// formatTime приводит время к формату, в котором хранится created_at.
+// Строки RFC3339 в UTC сравниваются как текст в хронологическом порядке
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestDailyCounts проверяет подсчёт посылок по дням
+func TestDailyCounts(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for _, createdAt := range []string{
+		"2024-06-01T08:00:00Z",
+		"2024-06-01T23:59:59Z",
+		"2024-06-03T12:00:00Z",
+		"2024-06-10T00:00:00Z",
+	} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	counts, err := store.DailyCounts(from, to)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"2024-06-01": 2, "2024-06-03": 1}, counts)
+}
+
+// TestGlobalStatusCounts проверяет подсчёт посылок по статусам
+func TestGlobalStatusCounts(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Client = 1000 + i
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		if i == 0 {
+			err = store.SetStatus(id, ParcelStatusSent)
+			require.NoError(t, err)
+		}
+	}
+
+	// check
+	counts, err := store.GlobalStatusCounts()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{ParcelStatusRegistered: 2, ParcelStatusSent: 1}, counts)
+}
+
+// TestWeightByStatus проверяет суммарный вес посылок по статусам
+func TestWeightByStatus(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for i, weight := range []float64{1.5, 2, 0.25} {
+		parcel := getTestParcel()
+		parcel.Weight = weight
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		if i == 0 {
+			require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		}
+	}
+
+	// check
+	weights, err := store.WeightByStatus()
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{ParcelStatusRegistered: 2.25, ParcelStatusSent: 1.5}, weights)
+}
+
+// TestCountByAddressPrefix проверяет подсчёт посылок по началу адреса
+func TestCountByAddressPrefix(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for _, address := range []string{"Москва, Тверская 1", "Москва, Арбат 2", "Казань, Баумана 3"} {
+		parcel := getTestParcel()
+		parcel.Address = address
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check: префикс считается в символах, а не в байтах
+	counts, err := store.CountByAddressPrefix(6)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"Москва": 2, "Казань": 1}, counts)
+
+	_, err = store.CountByAddressPrefix(0)
+	require.Error(t, err)
+}
+
+// TestCountByClientSince проверяет подсчёт посылок клиента за скользящее окно
+func TestCountByClientSince(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for _, createdAt := range []string{"2024-06-10T10:30:00Z", "2024-06-10T11:15:00Z", "2024-06-10T11:45:00Z"} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// граница в другом часовом поясе: 14:00 по Москве — 11:00 UTC
+	moscow := time.FixedZone("MSK", 3*60*60)
+	count, err := store.CountByClientSince(1000, time.Date(2024, 6, 10, 14, 0, 0, 0, moscow))
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	count, err = store.CountByClientSince(1001, time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+// TestCountSince проверяет обнаружение новых посылок по наибольшему номеру
+func TestCountSince(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	last, err := store.MaxNumber()
+	require.NoError(t, err)
+	require.Zero(t, last)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	last, err = store.MaxNumber()
+	require.NoError(t, err)
+	require.Equal(t, id, last)
+
+	// poll
+	for i := 0; i < 3; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+	count, err := store.CountSince(last)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	last, err = store.MaxNumber()
+	require.NoError(t, err)
+	count, err = store.CountSince(last)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+// TestDeliveryRate проверяет долю доставленных посылок клиента
+func TestDeliveryRate(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	rate, err := store.DeliveryRate(1000)
+	require.NoError(t, err)
+	require.Zero(t, rate)
+
+	for _, final := range []string{ParcelStatusDelivered, ParcelStatusDelivered, ParcelStatusDelivered, ParcelStatusLost, ParcelStatusSent, ""} {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		if final == "" {
+			continue
+		}
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		if final != ParcelStatusSent {
+			require.NoError(t, store.SetStatus(id, final))
+		}
+	}
+
+	// check
+	rate, err = store.DeliveryRate(1000)
+	require.NoError(t, err)
+	require.Equal(t, 0.75, rate)
+}
+
+// TestThroughput проверяет подсчёт созданных и доставленных за период посылок
+func TestThroughput(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithClock(func() time.Time { return now }))
+
+	for _, createdAt := range []string{"2024-06-01T10:00:00Z", "2024-06-09T10:00:00Z", "2024-06-10T10:00:00Z"} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		if createdAt < "2024-06-10" {
+			require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+		}
+	}
+
+	// check: граница в другом часовом поясе, 03:00 по Москве — 00:00 UTC
+	moscow := time.FixedZone("MSK", 3*60*60)
+	created, delivered, err := store.Throughput(time.Date(2024, 6, 9, 3, 0, 0, 0, moscow), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, created)
+	require.Equal(t, 2, delivered)
+
+	created, delivered, err = store.Throughput(now.Add(time.Hour), now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, created)
+	require.Zero(t, delivered)
+}
+
+// TestCountByClientAndStatus проверяет количество посылок по клиентам и статусам
+func TestCountByClientAndStatus(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	for i := 0; i < 4; i++ {
+		parcel := getTestParcel()
+		parcel.Client = 1000 + i%2
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		if i == 0 {
+			err = store.SetStatus(id, ParcelStatusSent)
+			require.NoError(t, err)
+		}
+	}
+
+	// check
+	counts, err := store.CountByClientAndStatus()
+	require.NoError(t, err)
+	require.Equal(t, map[int]map[string]int{
+		1000: {ParcelStatusRegistered: 1, ParcelStatusSent: 1},
+		1001: {ParcelStatusRegistered: 2},
+	}, counts)
+}
+
+// TestAverageAgeByStatus проверяет средний возраст посылок по статусам
+func TestAverageAgeByStatus(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithClock(func() time.Time { return now }))
+
+	ages := []time.Duration{2 * time.Hour, 4 * time.Hour, 10 * time.Hour}
+	var numbers []int
+	for _, age := range ages {
+		parcel := getTestParcel()
+		parcel.CreatedAt = formatTime(now.Add(-age))
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	err := store.SetStatus(numbers[2], ParcelStatusSent)
+	require.NoError(t, err)
+
+	// строки с неразбираемым или пустым временем пропускаются
+	for _, createdAt := range []string{"10.06.2024", ""} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+		_, err = store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	avg, err := store.AverageAgeByStatus()
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		ParcelStatusRegistered: 3 * time.Hour,
+		ParcelStatusSent:       10 * time.Hour,
+	}, avg)
+}
+
+// TestDistinctStatuses проверяет список встречающихся статусов
+func TestDistinctStatuses(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	statuses, err := store.DistinctStatuses()
+	require.NoError(t, err)
+	require.NotNil(t, statuses)
+	require.Empty(t, statuses)
+
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		if i == 0 {
+			require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		}
+	}
+	// статус из старой системы
+	_, err = db.Exec("UPDATE parcel SET status = 'REGISTERED' WHERE number = 3")
+	require.NoError(t, err)
+
+	// check
+	statuses, err = store.DistinctStatuses()
+	require.NoError(t, err)
+	require.Equal(t, []string{"REGISTERED", ParcelStatusRegistered, ParcelStatusSent}, statuses)
+}
+
+// TestEstimateClientBytes проверяет оценку объёма данных клиента
+func TestEstimateClientBytes(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	size, err := store.EstimateClientBytes(1000)
+	require.NoError(t, err)
+	require.Zero(t, size)
+
+	parcel := getTestParcel()
+	parcel.Address = "улица"
+	_, err = store.Add(parcel)
+	require.NoError(t, err)
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	size, err = store.EstimateClientBytes(parcel.Client)
+	require.NoError(t, err)
+	row := len(ParcelStatusRegistered) + len(parcel.CreatedAt) + rowOverheadBytes
+	require.Equal(t, int64(len("улица")+len("test")+2*row), size)
+}
+
+// TestClientStats проверяет пересчёт и чтение кэша количества посылок клиента
+func TestClientStats(t *testing.T) {
+	// prepare
+	db := openTestDB(t, WithClientStats())
+	store := NewParcelStore(db)
+
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		if i == 0 {
+			require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		}
+	}
+
+	stats, err := store.GetClientStats(1000)
+	require.NoError(t, err)
+	require.Empty(t, stats)
+
+	// refresh
+	require.NoError(t, store.RefreshClientStats(1000))
+	stats, err = store.GetClientStats(1000)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{ParcelStatusRegistered: 2, ParcelStatusSent: 1}, stats)
+
+	// до пересчёта кэш не меняется
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+	stats, err = store.GetClientStats(1000)
+	require.NoError(t, err)
+	require.Equal(t, 2, stats[ParcelStatusRegistered])
+
+	require.NoError(t, store.RefreshClientStats(1000))
+	stats, err = store.GetClientStats(1000)
+	require.NoError(t, err)
+	require.Equal(t, 3, stats[ParcelStatusRegistered])
+}
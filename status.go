@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition возвращается при недопустимой смене статуса
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// ErrUnknownStatus возвращается, если статус не входит в число известных
+var ErrUnknownStatus = errors.New("unknown parcel status")
+
+// ErrUnexpectedStatus возвращается RequireStatus, если посылка в другом статусе
+var ErrUnexpectedStatus = errors.New("unexpected parcel status")
+
+// transitions описывает допустимые переходы между статусами посылки
+var transitions = map[string][]string{
+	ParcelStatusRegistered: {ParcelStatusSent},
+	ParcelStatusSent:       {ParcelStatusDelivered, ParcelStatusLost},
+	ParcelStatusDelivered:  {},
+	ParcelStatusLost:       {ParcelStatusRegistered},
+}
+
+// transition переход посылки из одного статуса в другой
+type transition struct {
+	from, to string
+}
+
+// reasonRequired переходы, которые при ручной смене статуса
+// нельзя выполнить без указания причины
+var reasonRequired = map[transition]bool{
+	{ParcelStatusSent, ParcelStatusDelivered}: true,
+	{ParcelStatusSent, ParcelStatusLost}:      true,
+}
+
+// validateTransition проверяет, что посылку можно перевести из статуса from в статус to
+func validateTransition(from, to string) error {
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+}
+
+// AllowedTransitions возвращает статусы, в которые можно перевести посылку из статуса from.
+// Для конечных и неизвестных статусов срез пустой, но не nil.
+// Срез — копия, его изменение не влияет на правила хранилища
+func AllowedTransitions(from string) []string {
+	return append([]string{}, transitions[from]...)
+}
+
+// RequireStatus проверяет, что посылка в статусе expected. Если посылки нет,
+// возвращает ErrParcelNotFound, если статус другой — ErrUnexpectedStatus с фактическим статусом.
+// Проверка не блокирует посылку: между ней и следующим действием статус может измениться,
+// для атомарной смены статуса есть SetStatusIfCurrent
+func (s ParcelStore) RequireStatus(number int, expected string) error {
+	var status string
+	err := s.queryRow("SELECT {status} FROM parcel WHERE {number} = ?", number).Scan(&status)
+	if err != nil {
+		return notFound(err)
+	}
+	if status != expected {
+		return fmt.Errorf("%w: parcel %d is %s, expected %s", ErrUnexpectedStatus, number, status, expected)
+	}
+
+	return nil
+}
+
+// terminalStatuses статусы, в которых доставка завершена: посылка доставлена или потеряна
+var terminalStatuses = map[string]bool{
+	ParcelStatusDelivered: true,
+	ParcelStatusLost:      true,
+}
+
+// IsTerminal проверяет, завершена ли доставка посылки в статусе status.
+// Потерянную посылку можно вернуть в работу через Reactivate, но пока этого
+// не сделано, она считается завершённой, как и в DeliveryRate
+func IsTerminal(status string) bool {
+	return terminalStatuses[status]
+}
+
+// canonicalStatuses известные статусы в порядке жизненного цикла
+var canonicalStatuses = []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusDelivered, ParcelStatusLost}
+
+// canonicalArgs возвращает canonicalStatuses как аргументы запроса
+func canonicalArgs() []any {
+	args := make([]any, 0, len(canonicalStatuses))
+	for _, status := range canonicalStatuses {
+		args = append(args, status)
+	}
+
+	return args
+}
+
+// FindNonCanonicalStatuses возвращает номера посылок, статус которых не совпадает
+// ни с одной из констант, например "REGISTERED" или "Sent" из старых импортов,
+// вместе с этими статусами
+func (s ParcelStore) FindNonCanonicalStatuses() (map[int]string, error) {
+	rows, err := s.query("SELECT {number}, {status} FROM parcel WHERE {status} NOT IN ("+placeholders(len(canonicalStatuses))+")",
+		canonicalArgs()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[int]string{}
+	for rows.Next() {
+		var number int
+		var status string
+		if err := rows.Scan(&number, &status); err != nil {
+			return nil, err
+		}
+		res[number] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// NormalizeStatuses переписывает статусы посылок по mapping (старое значение → известный статус)
+// в одной транзакции и возвращает число изменённых посылок. Если какое-то целевое значение
+// не входит в известные статусы, ничего не меняется. Ключи, которые сами являются
+// известными статусами, пропускаются: посылки с правильным статусом не трогаются.
+// Это чистка данных при миграции, история статусов и события не записываются
+func (s ParcelStore) NormalizeStatuses(mapping map[string]string) (int, error) {
+	for from, to := range mapping {
+		if _, ok := transitions[to]; !ok {
+			return 0, fmt.Errorf("%w: %q for %q", ErrUnknownStatus, to, from)
+		}
+	}
+
+	updated := 0
+	err := s.update(func(tx storeTx) error {
+		now := formatTime(s.now())
+		updated = 0
+		for from, to := range mapping {
+			if _, ok := transitions[from]; ok {
+				continue
+			}
+
+			res, err := tx.Exec("UPDATE parcel SET {status} = ?, updated_at = ? WHERE {status} = ?", to, now, from)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			updated += int(n)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAllowedTransitions проверяет список доступных переходов
+func TestAllowedTransitions(t *testing.T) {
+	require.Equal(t, []string{ParcelStatusSent}, AllowedTransitions(ParcelStatusRegistered))
+	require.Equal(t, []string{ParcelStatusDelivered, ParcelStatusLost}, AllowedTransitions(ParcelStatusSent))
+
+	// конечный и неизвестный статусы
+	require.NotNil(t, AllowedTransitions(ParcelStatusDelivered))
+	require.Empty(t, AllowedTransitions(ParcelStatusDelivered))
+	require.Empty(t, AllowedTransitions("shipped"))
+
+	// изменение результата не меняет правила
+	next := AllowedTransitions(ParcelStatusSent)
+	next[0] = ParcelStatusRegistered
+	require.NoError(t, validateTransition(ParcelStatusSent, ParcelStatusDelivered))
+}
+
+// TestRequireStatus проверяет проверку статуса посылки перед действием
+func TestRequireStatus(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	require.NoError(t, store.RequireStatus(id, ParcelStatusRegistered))
+
+	err = store.RequireStatus(id, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrUnexpectedStatus)
+	require.Contains(t, err.Error(), ParcelStatusRegistered)
+
+	err = store.RequireStatus(id+1, ParcelStatusRegistered)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestIsTerminal проверяет признак завершённой доставки для каждого статуса
+func TestIsTerminal(t *testing.T) {
+	require.False(t, IsTerminal(ParcelStatusRegistered))
+	require.False(t, IsTerminal(ParcelStatusSent))
+	require.True(t, IsTerminal(ParcelStatusDelivered))
+	require.True(t, IsTerminal(ParcelStatusLost))
+
+	// неизвестные и записанные иначе статусы
+	require.False(t, IsTerminal("cancelled"))
+	require.False(t, IsTerminal("Delivered"))
+	require.False(t, IsTerminal(""))
+}
+
+// TestNormalizeStatuses проверяет поиск и исправление статусов из старых импортов
+func TestNormalizeStatuses(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 4; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	_, err := db.Exec("UPDATE parcel SET status = 'REGISTERED' WHERE number IN (?, ?)", numbers[0], numbers[1])
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE parcel SET status = 'Sent' WHERE number = ?", numbers[2])
+	require.NoError(t, err)
+
+	found, err := store.FindNonCanonicalStatuses()
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{numbers[0]: "REGISTERED", numbers[1]: "REGISTERED", numbers[2]: "Sent"}, found)
+
+	// неизвестный целевой статус ничего не меняет
+	_, err = store.NormalizeStatuses(map[string]string{"Sent": "shipped"})
+	require.ErrorIs(t, err, ErrUnknownStatus)
+
+	// normalize: известный статус в ключе пропускается
+	n, err := store.NormalizeStatuses(map[string]string{
+		"REGISTERED":           ParcelStatusRegistered,
+		"Sent":                 ParcelStatusSent,
+		ParcelStatusRegistered: ParcelStatusLost,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	// check
+	found, err = store.FindNonCanonicalStatuses()
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	for i, want := range []string{ParcelStatusRegistered, ParcelStatusRegistered, ParcelStatusSent, ParcelStatusRegistered} {
+		stored, err := store.Get(numbers[i])
+		require.NoError(t, err)
+		require.Equal(t, want, stored.Status)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// ParcelWithTags посылка вместе с её метками
+type ParcelWithTags struct {
+	Parcel
+	Tags []string
+}
+
+// AddTag добавляет посылке метку. Повторное добавление той же метки ничего не меняет
+func (s ParcelStore) AddTag(number int, tag string) error {
+	_, err := s.exec("INSERT INTO parcel_tag (number, tag) VALUES (?, ?) ON CONFLICT DO NOTHING", number, tag)
+	return err
+}
+
+// GetTags возвращает метки посылки в алфавитном порядке
+func (s ParcelStore) GetTags(number int) ([]string, error) {
+	return queryAll(s, scanString, "SELECT tag FROM parcel_tag WHERE number = ? ORDER BY tag", number)
+}
+
+// GetByClientWithTags возвращает посылки клиента вместе с метками одним запросом.
+// У посылок без меток срез Tags пустой, но не nil
+func (s ParcelStore) GetByClientWithTags(client int) ([]ParcelWithTags, error) {
+	rows, err := s.query(`SELECT p.{number}, p.{client}, p.{status}, p.{address}, p.{created_at}, p.updated_at, p.priority, p.carrier, p.notes, p.weight, p.length, p.width, p.height, t.tag
+		FROM parcel p LEFT JOIN parcel_tag t ON t.number = p.{number}
+		WHERE p.{client} = ?
+		ORDER BY p.{number}, t.tag`, client)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []ParcelWithTags{}
+	for rows.Next() {
+		var tag sql.NullString
+		p, err := scanParcel(rows, &tag)
+		if err != nil {
+			return nil, err
+		}
+
+		// строки одной посылки идут подряд благодаря сортировке по номеру
+		if len(res) == 0 || res[len(res)-1].Number != p.Number {
+			res = append(res, ParcelWithTags{Parcel: p, Tags: []string{}})
+		}
+		if tag.Valid {
+			last := &res[len(res)-1]
+			last.Tags = append(last.Tags, tag.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
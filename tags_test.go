@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetByClientWithTags проверяет получение посылок клиента вместе с метками
+func TestGetByClientWithTags(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	tagged, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	untagged, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	require.NoError(t, store.AddTag(tagged, "fragile"))
+	require.NoError(t, store.AddTag(tagged, "express"))
+	require.NoError(t, store.AddTag(tagged, "express"))
+
+	// check
+	tags, err := store.GetTags(tagged)
+	require.NoError(t, err)
+	require.Equal(t, []string{"express", "fragile"}, tags)
+
+	parcels, err := store.GetByClientWithTags(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, tagged, parcels[0].Number)
+	require.Equal(t, []string{"express", "fragile"}, parcels[0].Tags)
+	require.Equal(t, untagged, parcels[1].Number)
+	require.NotNil(t, parcels[1].Tags)
+	require.Empty(t, parcels[1].Tags)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ParcelWithAge посылка вместе с её возрастом по часам хранилища.
+// Если created_at не разбирается, Age нулевой, а InvalidCreatedAt установлен
+type ParcelWithAge struct {
+	Parcel
+	Age              time.Duration
+	InvalidCreatedAt bool
+}
+
+// GetByClientWithAge возвращает посылки клиента вместе с их возрастом,
+// например для подписи «зарегистрирована 3 дня назад»
+func (s ParcelStore) GetByClientWithAge(client int) ([]ParcelWithAge, error) {
+	parcels, err := s.GetByClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	res := make([]ParcelWithAge, 0, len(parcels))
+	for _, p := range parcels {
+		item := ParcelWithAge{Parcel: p}
+		created, err := p.CreatedTime()
+		if err != nil {
+			item.InvalidCreatedAt = true
+		} else {
+			item.Age = now.Sub(created)
+		}
+		res = append(res, item)
+	}
+
+	return res, nil
+}
+
+// FindInvalidTimestamps возвращает посылки, у которых created_at не разбирается как RFC3339.
+// Это диагностика перед нормализацией времени, данные она не меняет
+func (s ParcelStore) FindInvalidTimestamps() ([]Parcel, error) {
+	rows, err := s.query("SELECT " + parcelColumns + " FROM parcel ORDER BY {number}")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Parcel{}
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := time.Parse(time.RFC3339, p.CreatedAt); err != nil {
+			res = append(res, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// normalizeBatch сколько строк NormalizeStoredTimestamps обрабатывает в одной транзакции
+const normalizeBatch = 500
+
+// NormalizeStoredTimestamps переписывает created_at в UTC RFC3339 там, где он хранится
+// в другом виде (например, со смещением часового пояса), и возвращает число изменённых строк.
+// Неразбираемые значения пропускаются, найти их можно через FindInvalidTimestamps.
+// Таблица обрабатывается пачками, каждая в своей транзакции, поэтому при ошибке
+// уже обработанные пачки остаются изменёнными. Повторный запуск безопасен
+func (s ParcelStore) NormalizeStoredTimestamps() (int, error) {
+	updated := 0
+	last := 0
+	for {
+		n, next, err := s.normalizeTimestampsAfter(last)
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+		if next == last {
+			return updated, nil
+		}
+		last = next
+	}
+}
+
+// normalizeTimestampsAfter нормализует одну пачку строк с номерами больше after.
+// Возвращает число изменённых строк и последний обработанный номер
+func (s ParcelStore) normalizeTimestampsAfter(after int) (int, int, error) {
+	var last int
+	var fixes map[int]string
+	err := s.update(func(tx storeTx) error {
+		rows, err := tx.Query("SELECT {number}, {created_at} FROM parcel WHERE {number} > ? ORDER BY {number} LIMIT ?",
+			after, normalizeBatch)
+		if err != nil {
+			return err
+		}
+
+		last = after
+		fixes = map[int]string{}
+		for rows.Next() {
+			var number int
+			var createdAt sql.NullString
+			if err := rows.Scan(&number, &createdAt); err != nil {
+				rows.Close()
+				return err
+			}
+			last = number
+
+			t, err := time.Parse(time.RFC3339, createdAt.String)
+			if err != nil {
+				continue
+			}
+			if normalized := formatTime(t); normalized != createdAt.String {
+				fixes[number] = normalized
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		now := formatTime(s.now())
+		for number, createdAt := range fixes {
+			_, err := tx.Exec("UPDATE parcel SET {created_at} = ?, updated_at = ? WHERE {number} = ?", createdAt, now, number)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, after, err
+	}
+
+	return len(fixes), last, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// addWithCreatedAt добавляет тестовую посылку с заданным created_at и возвращает её номер
+func addWithCreatedAt(t *testing.T, store ParcelStore, createdAt string) int {
+	parcel := getTestParcel()
+	parcel.CreatedAt = createdAt
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	return id
+}
+
+// TestGetByClientWithAge проверяет вычисление возраста посылок клиента
+func TestGetByClientWithAge(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	store := NewParcelStore(db, WithClock(func() time.Time { return now }))
+
+	addWithCreatedAt(t, store, "2024-06-07T12:00:00Z")
+	bad := addWithCreatedAt(t, store, "07.06.2024")
+
+	// check
+	parcels, err := store.GetByClientWithAge(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, 72*time.Hour, parcels[0].Age)
+	require.False(t, parcels[0].InvalidCreatedAt)
+	require.Equal(t, bad, parcels[1].Number)
+	require.Zero(t, parcels[1].Age)
+	require.True(t, parcels[1].InvalidCreatedAt)
+
+	parcels, err = store.GetByClientWithAge(1001)
+	require.NoError(t, err)
+	require.NotNil(t, parcels)
+	require.Empty(t, parcels)
+}
+
+// TestFindInvalidTimestamps проверяет поиск посылок с неразбираемым временем создания
+func TestFindInvalidTimestamps(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	addWithCreatedAt(t, store, "2024-06-01T10:00:00Z")
+	addWithCreatedAt(t, store, "2024-06-01T13:00:00+03:00")
+	bad := addWithCreatedAt(t, store, "01.06.2024 10:00")
+	empty := addWithCreatedAt(t, store, "")
+
+	// check
+	parcels, err := store.FindInvalidTimestamps()
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, bad, parcels[0].Number)
+	require.Equal(t, "01.06.2024 10:00", parcels[0].CreatedAt)
+	require.Equal(t, empty, parcels[1].Number)
+}
+
+// TestNormalizeStoredTimestamps проверяет приведение времени создания к UTC
+func TestNormalizeStoredTimestamps(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	utc := addWithCreatedAt(t, store, "2024-06-01T10:00:00Z")
+	offset := addWithCreatedAt(t, store, "2024-06-01T13:00:00+03:00")
+	bad := addWithCreatedAt(t, store, "01.06.2024 10:00")
+
+	// пачек больше одной
+	parcels := GenerateParcels(normalizeBatch + 10)
+	for i := range parcels {
+		parcels[i].CreatedAt = "2024-06-01T05:00:00-05:00"
+	}
+	_, err := store.BatchAdd(parcels)
+	require.NoError(t, err)
+
+	// normalize
+	n, err := store.NormalizeStoredTimestamps()
+	require.NoError(t, err)
+	require.Equal(t, len(parcels)+1, n)
+
+	// check
+	for id, expected := range map[int]string{
+		utc:    "2024-06-01T10:00:00Z",
+		offset: "2024-06-01T10:00:00Z",
+		bad:    "01.06.2024 10:00",
+	} {
+		stored, err := store.Get(id)
+		require.NoError(t, err)
+		require.Equal(t, expected, stored.CreatedAt)
+	}
+
+	n, err = store.NormalizeStoredTimestamps()
+	require.NoError(t, err)
+	require.Zero(t, n)
+}